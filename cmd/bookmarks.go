@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	ex "github.com/iansinnott/browser-gopher/pkg/extractors"
+	"github.com/iansinnott/browser-gopher/pkg/populate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var bookmarksCmd = &cobra.Command{
+	Use:   "bookmarks",
+	Short: "Import bookmarks from all known sources and index them for search",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		browserName, err := cmd.Flags().GetString("browser")
+		if err != nil {
+			fmt.Println("could not parse --browser:", err)
+			os.Exit(1)
+		}
+
+		extractors, err := ex.BuildExtractorList()
+		if err != nil {
+			log.Println("error getting extractors", err)
+			os.Exit(1)
+		}
+
+		errs := []error{}
+
+		for _, x := range extractors {
+			if browserName != "" && x.GetName() != browserName {
+				continue
+			}
+
+			if err := populate.PopulateBookmarks(x); err != nil {
+				errs = append(errs, errors.Wrap(err, x.GetName()+" error:"))
+			}
+		}
+
+		if len(errs) > 0 {
+			for _, e := range errs {
+				log.Println(e)
+			}
+			fmt.Println("one or more browsers failed")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bookmarksCmd)
+	bookmarksCmd.Flags().StringP("browser", "b", "", "Specify the browser name you'd like to extract bookmarks from")
+}
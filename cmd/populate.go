@@ -30,6 +30,12 @@ var populateCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			fmt.Println("could not parse --profile:", err)
+			os.Exit(1)
+		}
+
 		onlyLatest, err := cmd.Flags().GetBool("latest")
 		if err != nil {
 			fmt.Println("could not parse --latest:", err)
@@ -63,15 +69,19 @@ var populateCmd = &cobra.Command{
 				continue
 			}
 
+			profile := x.GetProfile()
+			if profileName != "" && profile.ProfileDisplayName != profileName && profile.ProfileID != profileName {
+				continue
+			}
+
 			since := time.Unix(0, 0) // 1970-01-01
 			if onlyLatest {
-				latestTime, err := persistence.GetLatestTime(cmd.Context(), dbConn, x)
-				if err != nil {
-					fmt.Println("could not get latest time", err)
-					os.Exit(1)
+				// A profile that's never been synced before has no rows in
+				// `visits` yet, so GetLatestTime returns sql.ErrNoRows -- fall back
+				// to a full import from epoch instead of treating that as fatal.
+				if latestTime, err := persistence.GetLatestTime(cmd.Context(), dbConn, x); err == nil && latestTime != nil {
+					since = *latestTime
 				}
-
-				since = *latestTime
 			}
 
 			var err error
@@ -113,6 +123,7 @@ var populateCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(populateCmd)
 	populateCmd.Flags().StringP("browser", "b", "", "Specify the browser name you'd like to extract")
+	populateCmd.Flags().StringP("profile", "p", "", "Further narrow --browser to a single profile, by name or id (e.g. \"Work\")")
 	populateCmd.Flags().Bool("latest", false, "Only populate data that's newer than last import (Recommended, likely will be default in future version)")
 	populateCmd.Flags().Bool("build-index", true, "Whether or not to build the search index. Required for search to work.")
 }
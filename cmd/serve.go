@@ -0,0 +1,64 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/iansinnott/browser-gopher/pkg/api"
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a local REST API over your indexed browser history",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, err := cmd.Flags().GetString("addr")
+		if err != nil {
+			fmt.Println("could not parse --addr:", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigCh
+			cancel()
+		}()
+
+		server, err := api.NewServer(ctx, config.Config)
+		if err != nil {
+			fmt.Println("could not start the api server", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+
+		httpServer := &http.Server{Addr: addr, Handler: server.Handler()}
+		go func() {
+			<-ctx.Done()
+			httpServer.Close()
+		}()
+
+		fmt.Printf("Serving the browser-gopher API on %s\n", addr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Println("api server stopped with an error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("addr", "127.0.0.1:8765", "Address to listen on")
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ex "github.com/iansinnott/browser-gopher/pkg/extractors"
+	"github.com/iansinnott/browser-gopher/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch browser history (and bookmarks) for changes and sync them live",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		browserName, err := cmd.Flags().GetString("browser")
+		if err != nil {
+			fmt.Println("could not parse --browser:", err)
+			os.Exit(1)
+		}
+
+		extractorList, err := ex.BuildExtractorList()
+		if err != nil {
+			log.Println("error getting extractors", err)
+			os.Exit(1)
+		}
+
+		if browserName != "" {
+			filtered := extractorList[:0]
+			for _, x := range extractorList {
+				if x.GetName() == browserName {
+					filtered = append(filtered, x)
+				}
+			}
+			extractorList = filtered
+		}
+
+		w := watcher.New(extractorList)
+		if w.TargetCount() == 0 {
+			fmt.Println("No history or bookmarks files found to watch")
+			os.Exit(1)
+		}
+		fmt.Printf("Watching %d files for changes. Press Ctrl+C to stop.\n", w.TargetCount())
+
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigCh
+			cancel()
+		}()
+
+		statusTicker := time.NewTicker(10 * time.Second)
+		defer statusTicker.Stop()
+		go func() {
+			for range statusTicker.C {
+				for _, s := range w.Status() {
+					if s.LastError != nil {
+						fmt.Printf("%s: error: %v\n", s.Path, s.LastError)
+						continue
+					}
+					fmt.Printf("%s: %d records added (last synced %s)\n", s.Path, s.RecordsAdded, s.LastSyncedAt.Format(time.Kitchen))
+				}
+			}
+		}()
+
+		if err := w.Run(ctx); err != nil {
+			fmt.Println("watcher stopped with an error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringP("browser", "b", "", "Only watch a single browser's files")
+}
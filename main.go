@@ -0,0 +1,10 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package main
+
+import "github.com/iansinnott/browser-gopher/cmd"
+
+func main() {
+	cmd.Execute()
+}
@@ -0,0 +1,256 @@
+// Package api exposes a small local REST API over our own database and
+// search index, so other tools (a browser extension, a script, a second
+// machine) can query browsing history without going through the CLI.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/iansinnott/browser-gopher/pkg/persistence"
+	"github.com/iansinnott/browser-gopher/pkg/search"
+)
+
+var (
+	errMissingUrlMd5     = errors.New("url_md5 is required")
+	errMissingQuery      = errors.New("q is required")
+	errIncompleteWebhook = errors.New("url, secret, and event are all required")
+)
+
+// Server serves the HTTP API described in the package doc.
+type Server struct {
+	ctx      context.Context
+	conf     *config.AppConfig
+	searcher search.BleveSearchProvider
+	webhooks *webhookDispatcher
+}
+
+// NewServer wires up a Server against conf, including a running webhook
+// delivery dispatcher. Callers must call Close when done.
+func NewServer(ctx context.Context, conf *config.AppConfig) (*Server, error) {
+	db, err := persistence.InitDb(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := newWebhookDispatcher(ctx, conf, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Server{
+		ctx:      ctx,
+		conf:     conf,
+		searcher: search.NewBleveSearchProvider(ctx, conf),
+		webhooks: webhooks,
+	}, nil
+}
+
+// Close stops the webhook dispatcher and releases its database connection.
+func (s *Server) Close() error {
+	return s.webhooks.Close()
+}
+
+// Handler returns the http.Handler to pass to http.Serve or http.ListenAndServe.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/urls/", s.handleUrlByMd5)
+	mux.HandleFunc("/urls", s.handleListUrls)
+	mux.HandleFunc("/visits", s.handleVisits)
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/webhooks", s.handleWebhooks)
+	return mux
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+// handleListUrls serves GET /urls?since=<unix_seconds>&limit=<n>&cursor=<c>.
+// Pass the response's next_cursor back as cursor to fetch the next page;
+// omit it (or pass "") to start from the most recently visited url.
+func (s *Server) handleListUrls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since := time.Unix(0, 0)
+	if v := r.URL.Query().Get("since"); v != "" {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		since = time.Unix(secs, 0)
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		limit = n
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+
+	conn, err := persistence.OpenConnection(r.Context(), s.conf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer conn.Close()
+
+	urls, err := persistence.ListUrls(r.Context(), conn, since, cursor, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var nextCursor string
+	if len(urls) == limit {
+		last := urls[len(urls)-1]
+		lastVisit := time.Unix(0, 0)
+		if last.LastVisit != nil {
+			lastVisit = *last.LastVisit
+		}
+		nextCursor = persistence.EncodeCursor(lastVisit, last.UrlMd5)
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"urls": urls, "next_cursor": nextCursor})
+}
+
+// handleUrlByMd5 serves GET /urls/{url_md5}.
+func (s *Server) handleUrlByMd5(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlMd5 := strings.TrimPrefix(r.URL.Path, "/urls/")
+	if urlMd5 == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	conn, err := persistence.OpenConnection(r.Context(), s.conf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer conn.Close()
+
+	urls, err := persistence.UrlsById(r.Context(), conn, urlMd5)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(urls) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJson(w, http.StatusOK, urls[0])
+}
+
+// handleVisits serves GET /visits?url_md5=....
+func (s *Server) handleVisits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlMd5 := r.URL.Query().Get("url_md5")
+	if urlMd5 == "" {
+		writeError(w, http.StatusBadRequest, errMissingUrlMd5)
+		return
+	}
+
+	conn, err := persistence.OpenConnection(r.Context(), s.conf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer conn.Close()
+
+	visits, err := persistence.VisitsByUrlMd5(r.Context(), conn, urlMd5)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"visits": visits})
+}
+
+// handleSearch serves GET /search?q=<query>&rank=1&kind=<history|bookmark>.
+// rank defaults to off and kind defaults to both, matching
+// BleveSearchProvider.SearchUrls's own defaults.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, errMissingQuery)
+		return
+	}
+
+	rank := r.URL.Query().Get("rank") == "1" || r.URL.Query().Get("rank") == "true"
+	kind := r.URL.Query().Get("kind")
+
+	result, err := s.searcher.SearchUrls(q, rank, kind)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, result)
+}
+
+// handleWebhooks serves POST /webhooks, registering a new delivery target.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Url    string `json:"url"`
+		Secret string `json:"secret"`
+		Event  string `json:"event"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Url == "" || body.Secret == "" || body.Event == "" {
+		writeError(w, http.StatusBadRequest, errIncompleteWebhook)
+		return
+	}
+
+	webhook, err := s.webhooks.Register(r.Context(), body.Url, body.Secret, body.Event)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, webhook)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/iansinnott/browser-gopher/pkg/webhooks"
+)
+
+// Delivery retry backoff: 5s, 10s, 20s, ... capped at 1 hour.
+const (
+	webhookBaseBackoff = 5 * time.Second
+	webhookMaxBackoff  = time.Hour
+	webhookMaxAttempts = 8
+	webhookWorkerCount = 4
+	webhookPollPeriod  = 2 * time.Second
+)
+
+// webhookDispatcher owns a bounded pool of workers that deliver pending
+// rows from webhook_deliveries, signing each payload with its webhook's
+// secret. Deliveries are persisted (via pkg/webhooks) before being
+// attempted, so a restart -- or a delivery enqueued by populate/watch while
+// no dispatcher was running at all -- resumes/picks up anything still
+// pending instead of silently dropping it.
+type webhookDispatcher struct {
+	ctx    context.Context
+	conf   *config.AppConfig
+	db     *sql.DB
+	cancel context.CancelFunc
+	jobs   chan int64
+	done   chan struct{}
+}
+
+func newWebhookDispatcher(ctx context.Context, conf *config.AppConfig, db *sql.DB) (*webhookDispatcher, error) {
+	if err := webhooks.EnsureTables(ctx, conf, db); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	d := &webhookDispatcher{
+		ctx:    ctx,
+		conf:   conf,
+		db:     db,
+		cancel: cancel,
+		jobs:   make(chan int64, 64),
+		done:   make(chan struct{}),
+	}
+
+	for i := 0; i < webhookWorkerCount; i++ {
+		go d.worker(ctx)
+	}
+	go d.poll(ctx)
+
+	return d, nil
+}
+
+// Close stops the dispatcher's workers and poller, then closes its
+// database connection.
+func (d *webhookDispatcher) Close() error {
+	d.cancel()
+	<-d.done
+	return d.db.Close()
+}
+
+// Register persists a new webhook. It doesn't schedule any deliveries --
+// that happens when Notify is called for a matching event.
+func (d *webhookDispatcher) Register(ctx context.Context, url, secret, event string) (*webhooks.Webhook, error) {
+	return webhooks.Register(ctx, d.conf, d.db, url, secret, event)
+}
+
+// Notify persists a delivery for every webhook registered for event, then
+// hands each one straight to this dispatcher's workers instead of waiting
+// for the next poll. populate/watch (which run as separate processes and
+// never construct a dispatcher) call webhooks.Notify directly instead --
+// their deliveries are picked up by whichever process's poll loop finds
+// them pending.
+func (d *webhookDispatcher) Notify(ctx context.Context, event string, payload interface{}) error {
+	deliveryIds, err := webhooks.Notify(ctx, d.conf, d.db, event, payload)
+	for _, id := range deliveryIds {
+		d.enqueue(id)
+	}
+	return err
+}
+
+func (d *webhookDispatcher) enqueue(deliveryId int64) {
+	select {
+	case d.jobs <- deliveryId:
+	default:
+		// The channel is full; the poller will pick this delivery back up on
+		// its next sweep since it's still "pending" in the database.
+	}
+}
+
+// poll periodically re-enqueues any delivery whose next_attempt_at has
+// passed, so deliveries left pending by a restart (or a full jobs channel)
+// are never stuck waiting forever.
+func (d *webhookDispatcher) poll(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(d.done)
+			return
+		case <-ticker.C:
+			d.enqueueDue(ctx)
+		}
+	}
+}
+
+func (d *webhookDispatcher) enqueueDue(ctx context.Context) {
+	qry := `SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= ?;`
+	if d.conf.DBDriver == "postgres" {
+		qry = `SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= $1;`
+	}
+
+	rows, err := d.db.QueryContext(ctx, qry, time.Now().Unix())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			d.enqueue(id)
+		}
+	}
+}
+
+func (d *webhookDispatcher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-d.jobs:
+			d.attemptDelivery(ctx, id)
+		}
+	}
+}
+
+func (d *webhookDispatcher) attemptDelivery(ctx context.Context, deliveryId int64) {
+	_, url, secret, payload, attempts, err := d.loadDelivery(ctx, deliveryId)
+	if err != nil {
+		return
+	}
+
+	sig := signPayload(secret, payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Browser-Gopher-Signature", "sha256="+sig)
+	}
+
+	var deliveryErr error
+	if err != nil {
+		deliveryErr = err
+	} else {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			deliveryErr = err
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				deliveryErr = httpStatusError(resp.StatusCode)
+			}
+		}
+	}
+
+	attempts++
+	if deliveryErr == nil {
+		d.markDelivered(ctx, deliveryId)
+		return
+	}
+
+	if attempts >= webhookMaxAttempts {
+		d.markFailed(ctx, deliveryId, attempts, deliveryErr)
+		return
+	}
+
+	d.markRetry(ctx, deliveryId, attempts, deliveryErr, backoffFor(attempts))
+}
+
+func (d *webhookDispatcher) loadDelivery(ctx context.Context, deliveryId int64) (webhookId int64, url, secret string, payload []byte, attempts int, err error) {
+	qry := `
+		SELECT
+			webhook_deliveries.webhook_id,
+			webhooks.url,
+			webhooks.secret,
+			webhook_deliveries.payload,
+			webhook_deliveries.attempts
+		FROM
+			webhook_deliveries
+			JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		WHERE
+			webhook_deliveries.id = ?;
+	`
+	if d.conf.DBDriver == "postgres" {
+		qry = `
+			SELECT
+				webhook_deliveries.webhook_id,
+				webhooks.url,
+				webhooks.secret,
+				webhook_deliveries.payload,
+				webhook_deliveries.attempts
+			FROM
+				webhook_deliveries
+				JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+			WHERE
+				webhook_deliveries.id = $1;
+		`
+	}
+
+	var payloadStr string
+	row := d.db.QueryRowContext(ctx, qry, deliveryId)
+	err = row.Scan(&webhookId, &url, &secret, &payloadStr, &attempts)
+	payload = []byte(payloadStr)
+	return
+}
+
+func (d *webhookDispatcher) markDelivered(ctx context.Context, deliveryId int64) {
+	d.updateDelivery(ctx, deliveryId, "delivered", 0, time.Now(), nil)
+}
+
+func (d *webhookDispatcher) markFailed(ctx context.Context, deliveryId int64, attempts int, cause error) {
+	d.updateDelivery(ctx, deliveryId, "failed", attempts, time.Now(), cause)
+}
+
+func (d *webhookDispatcher) markRetry(ctx context.Context, deliveryId int64, attempts int, cause error, delay time.Duration) {
+	d.updateDelivery(ctx, deliveryId, "pending", attempts, time.Now().Add(delay), cause)
+}
+
+func (d *webhookDispatcher) updateDelivery(ctx context.Context, deliveryId int64, status string, attempts int, nextAttempt time.Time, cause error) {
+	var lastError string
+	if cause != nil {
+		lastError = cause.Error()
+	}
+
+	qry := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?;`
+	if d.conf.DBDriver == "postgres" {
+		qry = `UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4 WHERE id = $5;`
+	}
+
+	d.db.ExecContext(ctx, qry, status, attempts, nextAttempt.Unix(), lastError, deliveryId)
+}
+
+// signPayload returns the hex-encoded HMAC-SHA256 of payload, keyed by
+// secret, so receivers can verify a delivery actually came from us.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoffFor returns the delay before retrying attempt, doubling each time
+// and capping at webhookMaxBackoff.
+func backoffFor(attempt int) time.Duration {
+	delay := webhookBaseBackoff << uint(attempt-1)
+	if delay > webhookMaxBackoff || delay <= 0 {
+		return webhookMaxBackoff
+	}
+	return delay
+}
+
+type httpStatusError int
+
+func (e httpStatusError) Error() string {
+	return "webhook endpoint returned status " + http.StatusText(int(e))
+}
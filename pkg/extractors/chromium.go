@@ -3,9 +3,13 @@ package extractors
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/iansinnott/browser-gopher/pkg/types"
 	"github.com/iansinnott/browser-gopher/pkg/util"
@@ -14,6 +18,7 @@ import (
 type ChromiumExtractor struct {
 	Name          string
 	HistoryDBPath string
+	Profile       types.Profile
 }
 
 const chromiumUrls = `
@@ -41,6 +46,10 @@ func (a *ChromiumExtractor) GetDBPath() string {
 	return a.HistoryDBPath
 }
 
+func (a *ChromiumExtractor) GetProfile() types.Profile {
+	return a.Profile
+}
+
 func (a *ChromiumExtractor) GetAllUrls(ctx context.Context, conn *sql.DB) ([]types.UrlRow, error) {
 	rows, err := conn.QueryContext(ctx, chromiumUrls)
 	if err != nil {
@@ -107,15 +116,87 @@ func (a *ChromiumExtractor) GetAllVisits(ctx context.Context, conn *sql.DB) ([]t
 	return visits, nil
 }
 
-func FindChromiumDBs(root string) ([]string, error) {
-	results := []string{}
+// chromiumBookmarkNode mirrors the subset of Chromium's Bookmarks JSON file
+// we care about. A node is either a "folder" (with children) or a "url"
+// (a leaf bookmark).
+type chromiumBookmarkNode struct {
+	Type         string                 `json:"type"`
+	Name         string                 `json:"name"`
+	Url          string                 `json:"url"`
+	DateAdded    string                 `json:"date_added"`
+	DateModified string                 `json:"date_modified"`
+	Children     []chromiumBookmarkNode `json:"children"`
+}
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if !d.IsDir() && d.Name() == "History" {
-			results = append(results, path)
-		}
+type chromiumBookmarksFile struct {
+	Roots struct {
+		BookmarkBar chromiumBookmarkNode `json:"bookmark_bar"`
+		Other       chromiumBookmarkNode `json:"other"`
+		Synced      chromiumBookmarkNode `json:"synced"`
+	} `json:"roots"`
+}
+
+// chromiumWebkitTimeToTime converts a Chromium bookmark timestamp (a
+// string-encoded count of microseconds since 1601-01-01, the same epoch
+// `visits` uses) into a time.Time.
+func chromiumWebkitTimeToTime(s string) *time.Time {
+	micros, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || micros == 0 {
 		return nil
-	})
+	}
+
+	epoch := time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := epoch.Add(time.Duration(micros) * time.Microsecond)
+	return &t
+}
+
+// walkChromiumBookmarks recursively walks a bookmark node, emitting a
+// BookmarkRow for every leaf ("url") node, tagging it with the full folder
+// path it was found under.
+func walkChromiumBookmarks(node chromiumBookmarkNode, folderPath string, extractorName string, out *[]types.BookmarkRow) {
+	if node.Type == "url" {
+		*out = append(*out, types.BookmarkRow{
+			Url:           node.Url,
+			Title:         node.Name,
+			FolderPath:    folderPath,
+			ExtractorName: extractorName,
+			AddedAt:       chromiumWebkitTimeToTime(node.DateAdded),
+			UpdatedAt:     chromiumWebkitTimeToTime(node.DateModified),
+		})
+		return
+	}
+
+	childPath := folderPath
+	if node.Name != "" {
+		childPath = path.Join(folderPath, node.Name)
+	}
 
-	return results, err
-}
\ No newline at end of file
+	for _, child := range node.Children {
+		walkChromiumBookmarks(child, childPath, extractorName, out)
+	}
+}
+
+// GetAllBookmarks parses the Bookmarks JSON file that lives alongside
+// History and returns every bookmark found under the bookmark_bar, other,
+// and synced roots. The conn argument is unused (bookmarks don't live in
+// the sqlite history db) but is kept to satisfy types.BookmarkExtractor.
+func (a *ChromiumExtractor) GetAllBookmarks(ctx context.Context, conn *sql.DB) ([]types.BookmarkRow, error) {
+	bookmarksPath := filepath.Join(filepath.Dir(a.HistoryDBPath), "Bookmarks")
+
+	data, err := os.ReadFile(bookmarksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var file chromiumBookmarksFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	var bookmarks []types.BookmarkRow
+	walkChromiumBookmarks(file.Roots.BookmarkBar, "", a.Name, &bookmarks)
+	walkChromiumBookmarks(file.Roots.Other, "", a.Name, &bookmarks)
+	walkChromiumBookmarks(file.Roots.Synced, "", a.Name, &bookmarks)
+
+	return bookmarks, nil
+}
@@ -11,11 +11,12 @@ import (
 type pathSpec struct {
 	name            string
 	path            string
-	findDBs         func(string) ([]string, error)
-	createExtractor func(name string, dbPath string) types.Extractor
+	profileManager  types.ProfileManager
+	createExtractor func(name string, profile types.Profile) types.Extractor
 }
 
-// Build a list of relevant extractors for this system
+// Build a list of relevant extractors for this system, one per browser
+// profile discovered on disk.
 // @todo If we want to go multi platform this is currently the place to specify
 // the logic to determine paths on a per-platform basis. The extractors should
 // all Just Work if they are pointed to an appropriate sqlite db.
@@ -24,41 +25,35 @@ func BuildExtractorList() ([]types.Extractor, error) {
 
 	pathsToTry := []pathSpec{
 		{
-			name:    "chrome",
-			path:    util.Expanduser("~/Library/Application Support/Google/Chrome/"),
-			findDBs: FindChromiumDBs,
-			createExtractor: func(name, dbPath string) types.Extractor {
-				return &ChromiumExtractor{Name: name, HistoryDBPath: dbPath}
+			name:           "chrome",
+			path:           util.Expanduser("~/Library/Application Support/Google/Chrome/"),
+			profileManager: ChromiumProfileManager{BrowserName: "chrome"},
+			createExtractor: func(name string, profile types.Profile) types.Extractor {
+				return &ChromiumExtractor{Name: name, HistoryDBPath: profile.DBPath, Profile: profile}
 			},
 		},
 		{
-			name:    "vivaldi",
-			path:    util.Expanduser("~/Library/Application Support/Vivaldi"),
-			findDBs: FindChromiumDBs,
-			createExtractor: func(name, dbPath string) types.Extractor {
-				return &ChromiumExtractor{Name: name, HistoryDBPath: dbPath}
+			name:           "vivaldi",
+			path:           util.Expanduser("~/Library/Application Support/Vivaldi"),
+			profileManager: ChromiumProfileManager{BrowserName: "vivaldi"},
+			createExtractor: func(name string, profile types.Profile) types.Extractor {
+				return &ChromiumExtractor{Name: name, HistoryDBPath: profile.DBPath, Profile: profile}
 			},
 		},
 		{
-			name:    "firefox",
-			path:    util.Expanduser("~/Library/Application Support/Firefox/Profiles/"),
-			findDBs: FindFirefoxDBs,
-			createExtractor: func(name, dbPath string) types.Extractor {
-				return &FirefoxExtractor{Name: name, HistoryDBPath: dbPath}
+			name:           "firefox",
+			path:           util.Expanduser("~/Library/Application Support/Firefox/"),
+			profileManager: FirefoxProfileManager{},
+			createExtractor: func(name string, profile types.Profile) types.Extractor {
+				return &FirefoxExtractor{Name: name, HistoryDBPath: profile.DBPath, Profile: profile}
 			},
 		},
 		{
-			name: "safari",
-			path: util.Expanduser("~/Library/Safari/"),
-			findDBs: func(s string) ([]string, error) {
-				dbPath := s + "History.db"
-				if _, err := os.Stat(dbPath); err != nil {
-					return nil, err
-				}
-				return []string{dbPath}, nil
-			},
-			createExtractor: func(name, dbPath string) types.Extractor {
-				return &SafariExtractor{Name: name, HistoryDBPath: dbPath}
+			name:           "safari",
+			path:           util.Expanduser("~/Library/Safari/"),
+			profileManager: SafariProfileManager{},
+			createExtractor: func(name string, profile types.Profile) types.Extractor {
+				return &SafariExtractor{Name: name, HistoryDBPath: profile.DBPath, Profile: profile}
 			},
 		},
 	}
@@ -70,12 +65,14 @@ func BuildExtractorList() ([]types.Extractor, error) {
 			continue
 		}
 
-		dbs, err := x.findDBs(x.path)
+		profiles, err := x.profileManager.ListProfiles(x.path)
 		if err != nil {
-			return nil, err
+			log.Println("could not list profiles for", x.name, err)
+			continue
 		}
-		for _, dbPath := range dbs {
-			result = append(result, x.createExtractor(x.name, dbPath))
+
+		for _, profile := range profiles {
+			result = append(result, x.createExtractor(x.name, profile))
 		}
 	}
 
@@ -0,0 +1,229 @@
+package extractors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/iansinnott/browser-gopher/pkg/types"
+	"github.com/iansinnott/browser-gopher/pkg/util"
+)
+
+type FirefoxExtractor struct {
+	Name          string
+	HistoryDBPath string
+	Profile       types.Profile
+}
+
+const firefoxUrls = `
+SELECT
+	url,
+	title
+FROM
+	moz_places;
+`
+
+const firefoxVisits = `
+SELECT
+  datetime(v.visit_date / 1e6, 'unixepoch') AS visit_date,
+  p.url
+FROM
+  moz_historyvisits v
+  INNER JOIN moz_places p ON v.place_id = p.id;
+`
+
+func (a *FirefoxExtractor) GetName() string {
+	return a.Name
+}
+
+func (a *FirefoxExtractor) GetDBPath() string {
+	return a.HistoryDBPath
+}
+
+func (a *FirefoxExtractor) GetProfile() types.Profile {
+	return a.Profile
+}
+
+func (a *FirefoxExtractor) GetAllUrls(ctx context.Context, conn *sql.DB) ([]types.UrlRow, error) {
+	rows, err := conn.QueryContext(ctx, firefoxUrls)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []types.UrlRow
+
+	for rows.Next() {
+		var x types.UrlRow
+		err = rows.Scan(&x.Url, &x.Title)
+		if err != nil {
+			fmt.Println("individual row error", err)
+			return nil, err
+		}
+		urls = append(urls, x)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		fmt.Println("row error", err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (a *FirefoxExtractor) GetAllVisits(ctx context.Context, conn *sql.DB) ([]types.VisitRow, error) {
+	rows, err := conn.QueryContext(ctx, firefoxVisits)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []types.VisitRow
+
+	for rows.Next() {
+		var x types.VisitRow
+		var ts string
+		err = rows.Scan(&ts, &x.Url)
+		if err != nil {
+			fmt.Println("individual row error", err)
+			return nil, err
+		}
+
+		t, err := util.ParseSQLiteDatetime(ts)
+		if err != nil {
+			fmt.Println("datetime parsing error", ts, err)
+			return nil, err
+		}
+		x.Datetime = t
+		visits = append(visits, x)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		fmt.Println("row error", err)
+		return nil, err
+	}
+
+	return visits, nil
+}
+
+const firefoxBookmarkFolders = `
+SELECT
+	id,
+	parent,
+	title
+FROM
+	moz_bookmarks
+WHERE
+	type = 2;
+`
+
+const firefoxBookmarks = `
+SELECT
+  b.parent,
+  b.title,
+  b.dateAdded,
+  b.lastModified,
+  p.url
+FROM
+  moz_bookmarks b
+  INNER JOIN moz_places p ON b.fk = p.id
+WHERE
+  b.type = 1;
+`
+
+// firefoxMicrosToTime converts a Firefox PRTime value (microseconds since
+// the unix epoch) into a time.Time.
+func firefoxMicrosToTime(micros int64) *time.Time {
+	if micros == 0 {
+		return nil
+	}
+	t := time.UnixMicro(micros)
+	return &t
+}
+
+// GetAllBookmarks reads moz_bookmarks joined with moz_places over the
+// existing Firefox connection, resolving each bookmark's folder id chain
+// into a slash-separated folder path.
+func (a *FirefoxExtractor) GetAllBookmarks(ctx context.Context, conn *sql.DB) ([]types.BookmarkRow, error) {
+	folderRows, err := conn.QueryContext(ctx, firefoxBookmarkFolders)
+	if err != nil {
+		return nil, err
+	}
+	defer folderRows.Close()
+
+	type folder struct {
+		parent int64
+		title  string
+	}
+	folders := map[int64]folder{}
+
+	for folderRows.Next() {
+		var id, parent int64
+		var title string
+		if err := folderRows.Scan(&id, &parent, &title); err != nil {
+			return nil, err
+		}
+		folders[id] = folder{parent: parent, title: title}
+	}
+	if err := folderRows.Err(); err != nil {
+		return nil, err
+	}
+
+	folderPath := func(id int64) string {
+		parts := []string{}
+		for {
+			f, ok := folders[id]
+			if !ok || f.title == "" {
+				break
+			}
+			parts = append([]string{f.title}, parts...)
+			id = f.parent
+		}
+		return path.Join(parts...)
+	}
+
+	rows, err := conn.QueryContext(ctx, firefoxBookmarks)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []types.BookmarkRow
+
+	for rows.Next() {
+		var parent int64
+		var title string
+		var dateAdded, lastModified int64
+		var url string
+
+		err = rows.Scan(&parent, &title, &dateAdded, &lastModified, &url)
+		if err != nil {
+			fmt.Println("individual row error", err)
+			return nil, err
+		}
+
+		bookmarks = append(bookmarks, types.BookmarkRow{
+			Url:           url,
+			Title:         title,
+			FolderPath:    folderPath(parent),
+			ExtractorName: a.Name,
+			AddedAt:       firefoxMicrosToTime(dateAdded),
+			UpdatedAt:     firefoxMicrosToTime(lastModified),
+		})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		fmt.Println("row error", err)
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
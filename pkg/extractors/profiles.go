@@ -0,0 +1,156 @@
+package extractors
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iansinnott/browser-gopher/pkg/types"
+)
+
+// chromiumLocalState mirrors the subset of Chromium's "Local State" JSON
+// file we need to resolve a profile directory's display name.
+type chromiumLocalState struct {
+	Profile struct {
+		InfoCache map[string]struct {
+			Name string `json:"name"`
+		} `json:"info_cache"`
+	} `json:"profile"`
+}
+
+// ChromiumProfileManager enumerates the profile directories under a
+// Chromium-family browser's root, using "Local State" for display names.
+type ChromiumProfileManager struct {
+	BrowserName string
+}
+
+func (m ChromiumProfileManager) ListProfiles(root string) ([]types.Profile, error) {
+	data, err := os.ReadFile(filepath.Join(root, "Local State"))
+	if err != nil {
+		return nil, err
+	}
+
+	var state chromiumLocalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	var profiles []types.Profile
+	for profileDir, info := range state.Profile.InfoCache {
+		dbPath := filepath.Join(root, profileDir, "History")
+		if _, err := os.Stat(dbPath); err != nil {
+			continue
+		}
+
+		profiles = append(profiles, types.Profile{
+			BrowserName:        m.BrowserName,
+			ProfileID:          profileDir,
+			ProfileDisplayName: info.Name,
+			DBPath:             dbPath,
+		})
+	}
+
+	return profiles, nil
+}
+
+// FirefoxProfileManager enumerates the profiles listed in a Firefox
+// installation's profiles.ini.
+type FirefoxProfileManager struct{}
+
+func (m FirefoxProfileManager) ListProfiles(root string) ([]types.Profile, error) {
+	f, err := os.Open(filepath.Join(root, "profiles.ini"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profiles []types.Profile
+	var name, path string
+	var isRelative bool
+	inProfileSection := false
+
+	flush := func() {
+		if name == "" && path == "" {
+			return
+		}
+
+		dbPath := path
+		if isRelative {
+			dbPath = filepath.Join(root, path)
+		}
+		dbPath = filepath.Join(dbPath, "places.sqlite")
+
+		if _, err := os.Stat(dbPath); err == nil {
+			profiles = append(profiles, types.Profile{
+				BrowserName:        "firefox",
+				ProfileID:          path,
+				ProfileDisplayName: name,
+				DBPath:             dbPath,
+			})
+		}
+
+		name, path = "", ""
+		isRelative = false
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if inProfileSection {
+				flush()
+			}
+			inProfileSection = strings.HasPrefix(line, "[Profile")
+			continue
+		}
+
+		if !inProfileSection {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "Name":
+			name = kv[1]
+		case "Path":
+			path = kv[1]
+		case "IsRelative":
+			isRelative = kv[1] == "1"
+		}
+	}
+	if inProfileSection {
+		flush()
+	}
+
+	return profiles, scanner.Err()
+}
+
+// SafariProfileManager always yields a single, synthetic profile -- Safari
+// doesn't support multiple profiles the way Chromium and Firefox do.
+type SafariProfileManager struct{}
+
+func (m SafariProfileManager) ListProfiles(root string) ([]types.Profile, error) {
+	dbPath := filepath.Join(root, "History.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+
+	return []types.Profile{
+		{
+			BrowserName:        "safari",
+			ProfileID:          "default",
+			ProfileDisplayName: "Safari",
+			DBPath:             dbPath,
+		},
+	}, nil
+}
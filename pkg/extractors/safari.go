@@ -0,0 +1,175 @@
+package extractors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/iansinnott/browser-gopher/pkg/types"
+	"github.com/iansinnott/browser-gopher/pkg/util"
+	"howett.net/plist"
+)
+
+type SafariExtractor struct {
+	Name          string
+	HistoryDBPath string
+	Profile       types.Profile
+}
+
+const safariUrls = `
+SELECT
+	url,
+	title
+FROM
+	history_items
+	LEFT JOIN history_visits ON history_visits.history_item = history_items.id
+GROUP BY
+	history_items.id;
+`
+
+// Safari stores visit times as seconds since the Mac absolute reference date
+// (2001-01-01), rather than unix epoch or Chromium's 1601-01-01 webkit epoch.
+const safariVisits = `
+SELECT
+  datetime(v.visit_time + strftime ('%s', '2001-01-01'), 'unixepoch') AS visit_date,
+  h.url
+FROM
+  history_visits v
+  INNER JOIN history_items h ON v.history_item = h.id;
+`
+
+func (a *SafariExtractor) GetName() string {
+	return a.Name
+}
+
+func (a *SafariExtractor) GetDBPath() string {
+	return a.HistoryDBPath
+}
+
+func (a *SafariExtractor) GetProfile() types.Profile {
+	return a.Profile
+}
+
+func (a *SafariExtractor) GetAllUrls(ctx context.Context, conn *sql.DB) ([]types.UrlRow, error) {
+	rows, err := conn.QueryContext(ctx, safariUrls)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []types.UrlRow
+
+	for rows.Next() {
+		var x types.UrlRow
+		err = rows.Scan(&x.Url, &x.Title)
+		if err != nil {
+			fmt.Println("individual row error", err)
+			return nil, err
+		}
+		urls = append(urls, x)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		fmt.Println("row error", err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (a *SafariExtractor) GetAllVisits(ctx context.Context, conn *sql.DB) ([]types.VisitRow, error) {
+	rows, err := conn.QueryContext(ctx, safariVisits)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []types.VisitRow
+
+	for rows.Next() {
+		var x types.VisitRow
+		var ts string
+		err = rows.Scan(&ts, &x.Url)
+		if err != nil {
+			fmt.Println("individual row error", err)
+			return nil, err
+		}
+
+		t, err := util.ParseSQLiteDatetime(ts)
+		if err != nil {
+			fmt.Println("datetime parsing error", ts, err)
+			return nil, err
+		}
+		x.Datetime = t
+		visits = append(visits, x)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		fmt.Println("row error", err)
+		return nil, err
+	}
+
+	return visits, nil
+}
+
+// safariBookmarkNode mirrors the subset of Safari's Bookmarks.plist we care
+// about. A node is either "WebBookmarkTypeList" (a folder, with Children)
+// or "WebBookmarkTypeLeaf" (an actual bookmark).
+type safariBookmarkNode struct {
+	WebBookmarkType string               `plist:"WebBookmarkType"`
+	URLString       string               `plist:"URLString"`
+	Title           string               `plist:"Title"`
+	Children        []safariBookmarkNode `plist:"Children"`
+}
+
+func walkSafariBookmarks(node safariBookmarkNode, folderPath string, extractorName string, out *[]types.BookmarkRow) {
+	if node.WebBookmarkType == "WebBookmarkTypeLeaf" {
+		*out = append(*out, types.BookmarkRow{
+			Url:           node.URLString,
+			Title:         node.Title,
+			FolderPath:    folderPath,
+			ExtractorName: extractorName,
+		})
+		return
+	}
+
+	childPath := folderPath
+	if node.Title != "" {
+		childPath = path.Join(folderPath, node.Title)
+	}
+
+	for _, child := range node.Children {
+		walkSafariBookmarks(child, childPath, extractorName, out)
+	}
+}
+
+// GetAllBookmarks parses ~/Library/Safari/Bookmarks.plist, which lives
+// alongside History.db. Safari doesn't track added/modified timestamps per
+// bookmark in the plist, so BookmarkRow.AddedAt/UpdatedAt are left nil.
+func (a *SafariExtractor) GetAllBookmarks(ctx context.Context, conn *sql.DB) ([]types.BookmarkRow, error) {
+	plistPath := filepath.Join(filepath.Dir(a.HistoryDBPath), "Bookmarks.plist")
+
+	f, err := os.Open(plistPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var root safariBookmarkNode
+	decoder := plist.NewDecoder(f)
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	var bookmarks []types.BookmarkRow
+	walkSafariBookmarks(root, "", a.Name, &bookmarks)
+
+	return bookmarks, nil
+}
@@ -1,221 +1,129 @@
+// Package persistence stores and retrieves urls, visits, and bookmarks.
+// The public functions in this file are a thin dispatch layer over the
+// Store interface: sqliteStore (the default, a local modernc.org/sqlite
+// database) or postgresStore (for a single history store shared across
+// multiple machines), selected by config.AppConfig.DBDriver.
 package persistence
 
 import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
-	_ "modernc.org/sqlite"
-
 	"github.com/iansinnott/browser-gopher/pkg/config"
 	"github.com/iansinnott/browser-gopher/pkg/types"
-	"github.com/iansinnott/browser-gopher/pkg/util"
-	"github.com/samber/lo"
 )
 
-// @note Initially visits had a unique index on `extractor_name, url_md5,
-// visit_time`, however, this lead to duplicate visits. The visits were
-// duplicated because some browsers will immport the history of other browsers,
-// or in cases like the history trends chrome extension duplication is
-// explicitly part of the goal. Thus, in order to minimize duplication visits
-// are considered unique by url and unix timestamp.
-const initSql = `
-CREATE TABLE IF NOT EXISTS "urls" (
-  "url_md5" VARCHAR(32) PRIMARY KEY NOT NULL,
-  "url" TEXT UNIQUE NOT NULL,
-  "title" TEXT,
-  "description" TEXT,
-  "last_visit" INTEGER
-);
-
-CREATE TABLE IF NOT EXISTS "urls_meta" (
-  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
-  "url_md5" VARCHAR(32) UNIQUE NOT NULL REFERENCES urls(url_md5),
-  "indexed_at" INTEGER
-);
-
-CREATE TABLE IF NOT EXISTS "visits" (
-  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
-  "url_md5" VARCHAR(32) NOT NULL REFERENCES urls(url_md5),
-  "visit_time" INTEGER,
-  "extractor_name" TEXT
-);
-
-CREATE UNIQUE INDEX IF NOT EXISTS visits_unique ON visits(url_md5, visit_time);
-CREATE INDEX IF NOT EXISTS visits_url_md5 ON visits(url_md5);
-`
-
-// Open a connection to the database. Calling code should close the connection when done.
-// @note It is assumed that the database is already initialized. Thus this may be less useful than `InitDB`
-func OpenConnection(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
-	dbPath := c.DBPath
-	conn, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, err
-	}
-
-	return conn, err
+// Store is the persistence backend's public surface.
+type Store interface {
+	OpenConnection(ctx context.Context, c *config.AppConfig) (*sql.DB, error)
+	InitDb(ctx context.Context, c *config.AppConfig) (*sql.DB, error)
+	InsertUrl(ctx context.Context, db *sql.DB, row *types.UrlRow) error
+	InsertUrlMeta(ctx context.Context, db *sql.DB, row *types.UrlMetaRow) error
+	InsertVisit(ctx context.Context, db *sql.DB, row *types.VisitRow) error
+	InsertBookmark(ctx context.Context, db *sql.DB, row *types.BookmarkRow) error
+	UrlsById(ctx context.Context, db *sql.DB, ids ...string) ([]types.UrlDbEntity, error)
+	ListUrls(ctx context.Context, db *sql.DB, since time.Time, cursor string, limit int) ([]types.UrlDbEntity, error)
+	VisitsByUrlMd5(ctx context.Context, db *sql.DB, urlMd5 string) ([]types.VisitDbEntity, error)
+	CountUrlsWhere(ctx context.Context, db *sql.DB, where string, args ...interface{}) (int, error)
+	GetLatestTime(ctx context.Context, db *sql.DB, extractor types.Extractor) (*time.Time, error)
+	GetVisitStats(ctx context.Context, db *sql.DB, ids ...string) (map[string]types.VisitStats, error)
 }
 
-// Initialize the database. Create tables and indexes
-func InitDb(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
-	conn, err := OpenConnection(ctx, c)
-	if err != nil {
-		return nil, err
+// storeFor resolves the Store implementation for c.DBDriver. An empty
+// DBDriver defaults to sqlite, so existing configs keep working unchanged.
+func storeFor(c *config.AppConfig) Store {
+	switch c.DBDriver {
+	case "postgres":
+		return postgresStore{}
+	default:
+		return sqliteStore{}
 	}
+}
 
-	_, err = conn.ExecContext(ctx, initSql)
+// OpenConnection opens a connection to the database. Calling code should
+// close the connection when done.
+// @note It is assumed that the database is already initialized. Thus this may be less useful than `InitDB`
+func OpenConnection(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
+	return storeFor(c).OpenConnection(ctx, c)
+}
 
-	return conn, err
+// InitDb initializes the database: creates tables and indexes.
+func InitDb(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
+	return storeFor(c).InitDb(ctx, c)
 }
 
 func GetLatestTime(ctx context.Context, db *sql.DB, extractor types.Extractor) (*time.Time, error) {
-	qry := `
-SELECT
-  visit_time
-FROM
-  visits
-WHERE extractor_name = ?
-ORDER BY
-  visit_time DESC
-LIMIT 1;
-	`
-	row := db.QueryRowContext(ctx, qry, extractor.GetName())
-	if err := row.Err(); err != nil {
-		return nil, err
-	}
-
-	var ts int64
-	err := row.Scan(&ts)
-	if err != nil {
-		return nil, err
-	}
-
-	t := time.Unix(ts, 0)
-
-	return &t, nil
-
+	return storeFor(config.Config).GetLatestTime(ctx, db, extractor)
 }
 
 func InsertUrl(ctx context.Context, db *sql.DB, row *types.UrlRow) error {
-	const qry = `
-		INSERT OR REPLACE INTO urls(url_md5, url, title, description, last_visit)
-			VALUES(?, ?, ?, ?, ?);
-	`
-	var lastVisit int64
-	if row.LastVisit != nil {
-		lastVisit = row.LastVisit.Unix()
-	}
-	md5 := util.HashMd5String(row.Url)
-
-	_, err := db.ExecContext(ctx, qry, md5, row.Url, row.Title, row.Description, lastVisit)
-	return err
+	return storeFor(config.Config).InsertUrl(ctx, db, row)
 }
 
 func InsertUrlMeta(ctx context.Context, db *sql.DB, row *types.UrlMetaRow) error {
-	const qry = `
-		INSERT OR REPLACE INTO urls_meta(url_md5, indexed_at)
-			VALUES(?, ?);
-	`
-	md5 := util.HashMd5String(row.Url)
-	var indexed_at int64
-
-	if row.IndexedAt != nil {
-		indexed_at = row.IndexedAt.Unix()
-	}
-
-	_, err := db.ExecContext(ctx, qry, md5, indexed_at)
-	return err
+	return storeFor(config.Config).InsertUrlMeta(ctx, db, row)
 }
 
 func InsertVisit(ctx context.Context, db *sql.DB, row *types.VisitRow) error {
-	const qry = `
-		INSERT OR IGNORE INTO visits(url_md5, visit_time, extractor_name)
-			VALUES(?, ?, ?);
-	`
-	md5 := util.HashMd5String(row.Url)
+	return storeFor(config.Config).InsertVisit(ctx, db, row)
+}
 
-	_, err := db.ExecContext(ctx, qry, md5, row.Datetime.Unix(), row.ExtractorName)
-	return err
+func InsertBookmark(ctx context.Context, db *sql.DB, row *types.BookmarkRow) error {
+	return storeFor(config.Config).InsertBookmark(ctx, db, row)
 }
 
-// Count the number of urls that match the given where clause. URL meta is available in the where clause as well.
+// CountUrlsWhere counts the number of urls that match the given where clause. URL meta is available in the where clause as well.
 func CountUrlsWhere(ctx context.Context, db *sql.DB, where string, args ...interface{}) (int, error) {
-	var qry = `
-		SELECT 
-			COUNT(*)
-		FROM
-			urls
-			LEFT OUTER JOIN urls_meta ON urls.url_md5 = urls_meta.url_md5
-		WHERE %s;
-	`
-	qry = fmt.Sprintf(qry, where)
-	row := db.QueryRowContext(ctx, qry, args...)
-	if err := row.Err(); err != nil {
-		return 0, err
-	}
+	return storeFor(config.Config).CountUrlsWhere(ctx, db, where, args...)
+}
 
-	var count int
-	err := row.Scan(&count)
-	if err != nil {
-		return 0, err
-	}
+func UrlsById(ctx context.Context, db *sql.DB, ids ...string) ([]types.UrlDbEntity, error) {
+	return storeFor(config.Config).UrlsById(ctx, db, ids...)
+}
 
-	return count, nil
+// ListUrls returns up to limit urls last visited at or after since, most
+// recently visited first. Results are ordered by (last_visit, url_md5), both
+// descending, so pages stay stable even when several urls share a
+// last_visit; cursor, built by EncodeCursor from the last url of a previous
+// page, resumes right after that url, and should otherwise be "".
+func ListUrls(ctx context.Context, db *sql.DB, since time.Time, cursor string, limit int) ([]types.UrlDbEntity, error) {
+	return storeFor(config.Config).ListUrls(ctx, db, since, cursor, limit)
 }
 
-func UrlsById(ctx context.Context, db *sql.DB, ids ...string) ([]types.UrlDbEntity, error) {
-	qry := fmt.Sprintf(
-		`SELECT 
-				url_md5,
-				url,
-				title,
-				description,
-				last_visit
-			FROM 
-				urls 
-			WHERE 
-				url_md5 IN (%s);
-		`,
-		strings.Join(
-			lo.Map(ids, func(id string, _ int) string { return "?" }),
-			",",
-		),
-	)
-
-	// C'mon Go, don't expose your implementation details (this conversion is
-	// necessary becuase of underlying mem representation):
-	// https://go.dev/doc/faq#convert_slice_of_interface
-	var args []any
-	for _, id := range ids {
-		args = append(args, id)
+// EncodeCursor builds the opaque pagination cursor ListUrls expects back,
+// from the last url's last_visit and url_md5.
+func EncodeCursor(lastVisit time.Time, urlMd5 string) string {
+	return fmt.Sprintf("%d_%s", lastVisit.Unix(), urlMd5)
+}
+
+// decodeCursor parses a cursor built by EncodeCursor.
+func decodeCursor(cursor string) (int64, string, error) {
+	visit, urlMd5, ok := strings.Cut(cursor, "_")
+	if !ok || urlMd5 == "" {
+		return 0, "", fmt.Errorf("invalid cursor %q", cursor)
 	}
 
-	rows, err := db.QueryContext(ctx, qry, args...)
+	ts, err := strconv.ParseInt(visit, 10, 64)
 	if err != nil {
-		return nil, err
+		return 0, "", fmt.Errorf("invalid cursor %q: %w", cursor, err)
 	}
-	defer rows.Close()
-
-	var urls []types.UrlDbEntity
-	for rows.Next() {
-		var url types.UrlDbEntity
-		var ts int64
 
-		err := rows.Scan(&url.UrlMd5, &url.Url, &url.Title, &url.Description, &ts)
-		if err != nil {
-			return nil, err
-		}
-
-		if ts != 0 {
-			t := time.Unix(ts, 0)
-			url.LastVisit = &t
-		}
+	return ts, urlMd5, nil
+}
 
-		urls = append(urls, url)
-	}
+// VisitsByUrlMd5 returns every recorded visit to the url identified by
+// urlMd5, most recent first.
+func VisitsByUrlMd5(ctx context.Context, db *sql.DB, urlMd5 string) ([]types.VisitDbEntity, error) {
+	return storeFor(config.Config).VisitsByUrlMd5(ctx, db, urlMd5)
+}
 
-	return urls, nil
+// GetVisitStats returns, for each of ids that has at least one recorded
+// visit, how many times it was visited and when it was last visited. Ids
+// with no visits are simply absent from the result.
+func GetVisitStats(ctx context.Context, db *sql.DB, ids ...string) (map[string]types.VisitStats, error) {
+	return storeFor(config.Config).GetVisitStats(ctx, db, ids...)
 }
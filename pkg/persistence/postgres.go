@@ -0,0 +1,484 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/iansinnott/browser-gopher/pkg/types"
+	"github.com/iansinnott/browser-gopher/pkg/util"
+)
+
+// postgresInitSql mirrors sqliteInitSql, swapping in Postgres-native types:
+// BYTEA for the raw md5 hash (rather than a VARCHAR), BIGSERIAL for
+// autoincrementing ids, and BIGINT for unix timestamps.
+const postgresInitSql = `
+CREATE TABLE IF NOT EXISTS urls (
+  url_md5 BYTEA PRIMARY KEY NOT NULL,
+  url TEXT UNIQUE NOT NULL,
+  title TEXT,
+  description TEXT,
+  last_visit BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS urls_meta (
+  id BIGSERIAL PRIMARY KEY,
+  url_md5 BYTEA UNIQUE NOT NULL REFERENCES urls(url_md5),
+  indexed_at BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS visits (
+  id BIGSERIAL PRIMARY KEY,
+  url_md5 BYTEA NOT NULL REFERENCES urls(url_md5),
+  visit_time BIGINT,
+  source TEXT,
+  profile TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS visits_unique ON visits(url_md5, visit_time, profile);
+CREATE INDEX IF NOT EXISTS visits_url_md5 ON visits(url_md5);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+  id BIGSERIAL PRIMARY KEY,
+  url_md5 BYTEA NOT NULL REFERENCES urls(url_md5),
+  title TEXT,
+  folder_path TEXT,
+  extractor_name TEXT,
+  added_at BIGINT,
+  updated_at BIGINT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS bookmarks_unique ON bookmarks(url_md5, folder_path, extractor_name);
+`
+
+// postgresStore is a Store backend for users who want a single history
+// store shared across multiple machines, which a synced sqlite file
+// handles poorly.
+type postgresStore struct{}
+
+func (postgresStore) OpenConnection(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
+	conn, err := sql.Open("postgres", c.DBDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (s postgresStore) InitDb(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
+	conn, err := s.OpenConnection(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, postgresInitSql); err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// md5Bytes decodes the hex-encoded md5 string util.HashMd5String produces
+// into the raw bytes stored in BYTEA columns.
+func md5Bytes(url string) ([]byte, error) {
+	return hex.DecodeString(util.HashMd5String(url))
+}
+
+func (postgresStore) GetLatestTime(ctx context.Context, db *sql.DB, extractor types.Extractor) (*time.Time, error) {
+	const qry = `
+SELECT
+  visit_time
+FROM
+  visits
+WHERE source = $1 AND profile = $2
+ORDER BY
+  visit_time DESC
+LIMIT 1;
+	`
+	row := db.QueryRowContext(ctx, qry, extractor.GetName(), extractor.GetProfile().ProfileID)
+	if err := row.Err(); err != nil {
+		return nil, err
+	}
+
+	var ts int64
+	if err := row.Scan(&ts); err != nil {
+		return nil, err
+	}
+
+	t := time.Unix(ts, 0)
+	return &t, nil
+}
+
+func (postgresStore) InsertUrl(ctx context.Context, db *sql.DB, row *types.UrlRow) error {
+	const qry = `
+		INSERT INTO urls(url_md5, url, title, description, last_visit)
+			VALUES($1, $2, $3, $4, $5)
+			ON CONFLICT (url_md5) DO UPDATE SET
+				url = EXCLUDED.url,
+				title = EXCLUDED.title,
+				description = EXCLUDED.description,
+				last_visit = GREATEST(COALESCE(urls.last_visit, 0), EXCLUDED.last_visit);
+	`
+	var lastVisit int64
+	if row.LastVisit != nil {
+		lastVisit = row.LastVisit.Unix()
+	}
+
+	md5, err := md5Bytes(row.Url)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, qry, md5, row.Url, row.Title, row.Description, lastVisit)
+	return err
+}
+
+func (postgresStore) InsertUrlMeta(ctx context.Context, db *sql.DB, row *types.UrlMetaRow) error {
+	const qry = `
+		INSERT INTO urls_meta(url_md5, indexed_at)
+			VALUES($1, $2)
+			ON CONFLICT (url_md5) DO UPDATE SET indexed_at = EXCLUDED.indexed_at;
+	`
+	md5, err := md5Bytes(row.Url)
+	if err != nil {
+		return err
+	}
+
+	var indexedAt int64
+	if row.IndexedAt != nil {
+		indexedAt = row.IndexedAt.Unix()
+	}
+
+	_, err = db.ExecContext(ctx, qry, md5, indexedAt)
+	return err
+}
+
+func (postgresStore) InsertVisit(ctx context.Context, db *sql.DB, row *types.VisitRow) error {
+	const qry = `
+		INSERT INTO visits(url_md5, visit_time, source, profile)
+			VALUES($1, $2, $3, $4)
+			ON CONFLICT (url_md5, visit_time, profile) DO NOTHING;
+	`
+	md5, err := md5Bytes(row.Url)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, qry, md5, row.Datetime.Unix(), row.ExtractorName, row.ProfileID); err != nil {
+		return err
+	}
+
+	// Nothing populates urls.last_visit on insert -- extractors only know a
+	// url's title/description, not when it was last visited -- so it has to
+	// be kept up to date here, where a visit time actually becomes available.
+	// GREATEST keeps it monotonic when visits for the same url arrive out of
+	// order (e.g. across profiles/browsers being synced independently).
+	const updateQry = `UPDATE urls SET last_visit = GREATEST(COALESCE(last_visit, 0), $1) WHERE url_md5 = $2;`
+	_, err = db.ExecContext(ctx, updateQry, row.Datetime.Unix(), md5)
+	return err
+}
+
+func (postgresStore) InsertBookmark(ctx context.Context, db *sql.DB, row *types.BookmarkRow) error {
+	const qry = `
+		INSERT INTO bookmarks(url_md5, title, folder_path, extractor_name, added_at, updated_at)
+			VALUES($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (url_md5, folder_path, extractor_name) DO UPDATE SET
+				title = EXCLUDED.title,
+				added_at = EXCLUDED.added_at,
+				updated_at = EXCLUDED.updated_at;
+	`
+	md5, err := md5Bytes(row.Url)
+	if err != nil {
+		return err
+	}
+
+	var addedAt, updatedAt int64
+	if row.AddedAt != nil {
+		addedAt = row.AddedAt.Unix()
+	}
+	if row.UpdatedAt != nil {
+		updatedAt = row.UpdatedAt.Unix()
+	}
+
+	_, err = db.ExecContext(ctx, qry, md5, row.Title, row.FolderPath, row.ExtractorName, addedAt, updatedAt)
+	return err
+}
+
+// CountUrlsWhere counts the number of urls that match the given where
+// clause. The clause is expected to use sqlite-style "?" placeholders, like
+// the sqlite backend -- they're rewritten to Postgres's "$1, $2, ..." here
+// so callers don't need to know which backend is active.
+func (postgresStore) CountUrlsWhere(ctx context.Context, db *sql.DB, where string, args ...interface{}) (int, error) {
+	qry := fmt.Sprintf(
+		`SELECT
+			COUNT(*)
+		FROM
+			urls
+			LEFT OUTER JOIN urls_meta ON urls.url_md5 = urls_meta.url_md5
+		WHERE %s;`,
+		positionalPlaceholders(where),
+	)
+
+	row := db.QueryRowContext(ctx, qry, args...)
+	if err := row.Err(); err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (postgresStore) UrlsById(ctx context.Context, db *sql.DB, ids ...string) ([]types.UrlDbEntity, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		decoded, err := hex.DecodeString(id)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = decoded
+	}
+
+	qry := fmt.Sprintf(
+		`SELECT
+				url_md5,
+				url,
+				title,
+				description,
+				last_visit
+			FROM
+				urls
+			WHERE
+				url_md5 IN (%s);
+		`,
+		strings.Join(placeholders, ","),
+	)
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []types.UrlDbEntity
+	for rows.Next() {
+		var url types.UrlDbEntity
+		var md5 []byte
+		var ts int64
+
+		if err := rows.Scan(&md5, &url.Url, &url.Title, &url.Description, &ts); err != nil {
+			return nil, err
+		}
+		url.UrlMd5 = hex.EncodeToString(md5)
+
+		if ts != 0 {
+			t := time.Unix(ts, 0)
+			url.LastVisit = &t
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// ListUrls returns up to limit urls last visited at or after since, most
+// recently visited first.
+func (postgresStore) ListUrls(ctx context.Context, db *sql.DB, since time.Time, cursor string, limit int) ([]types.UrlDbEntity, error) {
+	qry := `
+		SELECT
+			url_md5,
+			url,
+			title,
+			description,
+			last_visit
+		FROM
+			urls
+		WHERE
+			last_visit >= $1
+	`
+	args := []any{since.Unix()}
+
+	if cursor != "" {
+		cursorVisit, cursorMd5, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursorMd5Bytes, err := hex.DecodeString(cursorMd5)
+		if err != nil {
+			return nil, err
+		}
+		qry += ` AND (last_visit < $2 OR (last_visit = $2 AND url_md5 < $3))`
+		args = append(args, cursorVisit, cursorMd5Bytes)
+	}
+
+	qry += fmt.Sprintf(`
+		ORDER BY
+			last_visit DESC,
+			url_md5 DESC
+		LIMIT $%d;
+	`, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []types.UrlDbEntity
+	for rows.Next() {
+		var u types.UrlDbEntity
+		var md5 []byte
+		var ts int64
+
+		if err := rows.Scan(&md5, &u.Url, &u.Title, &u.Description, &ts); err != nil {
+			return nil, err
+		}
+		u.UrlMd5 = hex.EncodeToString(md5)
+
+		if ts != 0 {
+			t := time.Unix(ts, 0)
+			u.LastVisit = &t
+		}
+
+		urls = append(urls, u)
+	}
+
+	return urls, rows.Err()
+}
+
+// VisitsByUrlMd5 returns every recorded visit to the url identified by
+// urlMd5, most recent first.
+func (postgresStore) VisitsByUrlMd5(ctx context.Context, db *sql.DB, urlMd5 string) ([]types.VisitDbEntity, error) {
+	const qry = `
+		SELECT
+			url_md5,
+			visit_time,
+			source,
+			profile
+		FROM
+			visits
+		WHERE
+			url_md5 = $1
+		ORDER BY
+			visit_time DESC;
+	`
+
+	md5, err := hex.DecodeString(urlMd5)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, qry, md5)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []types.VisitDbEntity
+	for rows.Next() {
+		var v types.VisitDbEntity
+		var rowMd5 []byte
+		var ts int64
+
+		if err := rows.Scan(&rowMd5, &ts, &v.Source, &v.Profile); err != nil {
+			return nil, err
+		}
+		v.UrlMd5 = hex.EncodeToString(rowMd5)
+		v.VisitTime = time.Unix(ts, 0)
+
+		visits = append(visits, v)
+	}
+
+	return visits, rows.Err()
+}
+
+// GetVisitStats reports, for each of ids, the visit count and most recent
+// visit time, used by ranked search to weigh popularity and recency.
+func (postgresStore) GetVisitStats(ctx context.Context, db *sql.DB, ids ...string) (map[string]types.VisitStats, error) {
+	if len(ids) == 0 {
+		return map[string]types.VisitStats{}, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		decoded, err := hex.DecodeString(id)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = decoded
+	}
+
+	qry := fmt.Sprintf(
+		`SELECT
+				url_md5,
+				COUNT(*),
+				MAX(visit_time)
+			FROM
+				visits
+			WHERE
+				url_md5 IN (%s)
+			GROUP BY
+				url_md5;
+		`,
+		strings.Join(placeholders, ","),
+	)
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]types.VisitStats, len(ids))
+	for rows.Next() {
+		var md5 []byte
+		var s types.VisitStats
+		var ts int64
+
+		if err := rows.Scan(&md5, &s.Count, &ts); err != nil {
+			return nil, err
+		}
+
+		s.UrlMd5 = hex.EncodeToString(md5)
+		s.LastVisit = time.Unix(ts, 0)
+		stats[s.UrlMd5] = s
+	}
+
+	return stats, rows.Err()
+}
+
+// positionalPlaceholders rewrites each sqlite-style "?" in where into
+// Postgres's "$1, $2, ..." positional form, in order.
+func positionalPlaceholders(where string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range where {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,517 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/iansinnott/browser-gopher/pkg/types"
+	"github.com/iansinnott/browser-gopher/pkg/util"
+	"github.com/samber/lo"
+)
+
+// @note Initially visits had a unique index on `extractor_name, url_md5,
+// visit_time`, however, this lead to duplicate visits. The visits were
+// duplicated because some browsers will immport the history of other browsers,
+// or in cases like the history trends chrome extension duplication is
+// explicitly part of the goal. Thus, in order to minimize duplication visits
+// were made unique by url and unix timestamp. visits_unique now also
+// includes the profile (see migrateVisitsUniqueIndex), so the same url and
+// timestamp recorded under two different profiles are kept as two visits.
+const sqliteInitSql = `
+CREATE TABLE IF NOT EXISTS "urls" (
+  "url_md5" VARCHAR(32) PRIMARY KEY NOT NULL,
+  "url" TEXT UNIQUE NOT NULL,
+  "title" TEXT,
+  "description" TEXT,
+  "last_visit" INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS "urls_meta" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "url_md5" VARCHAR(32) UNIQUE NOT NULL REFERENCES urls(url_md5),
+  "indexed_at" INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS "visits" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "url_md5" VARCHAR(32) NOT NULL REFERENCES urls(url_md5),
+  "visit_time" INTEGER,
+  "source" TEXT,
+  "profile" TEXT
+);
+
+CREATE INDEX IF NOT EXISTS visits_url_md5 ON visits(url_md5);
+
+CREATE TABLE IF NOT EXISTS "bookmarks" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "url_md5" VARCHAR(32) NOT NULL REFERENCES urls(url_md5),
+  "title" TEXT,
+  "folder_path" TEXT,
+  "extractor_name" TEXT,
+  "added_at" INTEGER,
+  "updated_at" INTEGER
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS bookmarks_unique ON bookmarks(url_md5, folder_path, extractor_name);
+`
+
+// sqliteStore is the default Store backend, a local modernc.org/sqlite
+// database.
+type sqliteStore struct{}
+
+// OpenConnection opens a connection to the database. Calling code should close the connection when done.
+// @note It is assumed that the database is already initialized. Thus this may be less useful than `InitDB`
+func (sqliteStore) OpenConnection(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
+	dbPath := c.DBPath
+	conn, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, err
+}
+
+// InitDb initializes the database: creates tables and indexes, and runs any
+// pending migrations.
+func (s sqliteStore) InitDb(ctx context.Context, c *config.AppConfig) (*sql.DB, error) {
+	conn, err := s.OpenConnection(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, sqliteInitSql); err != nil {
+		return nil, err
+	}
+
+	if err := migrateVisitsSourceProfile(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	if err := migrateVisitsUniqueIndex(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// migrateVisitsSourceProfile upgrades databases created before multi-profile
+// support landed, where visits were tagged with a single `extractor_name`
+// column (the browser name, e.g. "chrome") rather than the `source`/`profile`
+// pair now used to distinguish individual browser profiles.
+func migrateVisitsSourceProfile(ctx context.Context, conn *sql.DB) error {
+	rows, err := conn.QueryContext(ctx, `PRAGMA table_info(visits);`)
+	if err != nil {
+		return err
+	}
+
+	var hasExtractorName, hasSource, hasProfile bool
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		switch name {
+		case "extractor_name":
+			hasExtractorName = true
+		case "source":
+			hasSource = true
+		case "profile":
+			hasProfile = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if hasExtractorName && !hasSource {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE visits RENAME COLUMN extractor_name TO source;`); err != nil {
+			return err
+		}
+	}
+
+	if !hasProfile {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE visits ADD COLUMN profile TEXT;`); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateVisitsUniqueIndex ensures visits_unique covers (url_md5,
+// visit_time, profile) rather than just (url_md5, visit_time): the
+// narrower index let two profiles (or browsers) visiting the same url in
+// the same second collide, silently losing one visit to INSERT OR IGNORE.
+// Must run after migrateVisitsSourceProfile, so the profile column it
+// indexes is guaranteed to already exist.
+func migrateVisitsUniqueIndex(ctx context.Context, conn *sql.DB) error {
+	rows, err := conn.QueryContext(ctx, `PRAGMA index_info(visits_unique);`)
+	if err != nil {
+		return err
+	}
+
+	var cols []string
+	for rows.Next() {
+		var seqno, cid int
+		var name string
+		if err := rows.Scan(&seqno, &cid, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		cols = append(cols, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if len(cols) == 3 && cols[2] == "profile" {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, `DROP INDEX IF EXISTS visits_unique;`); err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE UNIQUE INDEX visits_unique ON visits(url_md5, visit_time, profile);`)
+	return err
+}
+
+// GetLatestTime returns the most recent visit time recorded for a specific
+// browser profile, so incremental sync (`populate --latest`) can resume from
+// the right place per profile instead of per browser.
+func (sqliteStore) GetLatestTime(ctx context.Context, db *sql.DB, extractor types.Extractor) (*time.Time, error) {
+	qry := `
+SELECT
+  visit_time
+FROM
+  visits
+WHERE source = ? AND profile = ?
+ORDER BY
+  visit_time DESC
+LIMIT 1;
+	`
+	row := db.QueryRowContext(ctx, qry, extractor.GetName(), extractor.GetProfile().ProfileID)
+	if err := row.Err(); err != nil {
+		return nil, err
+	}
+
+	var ts int64
+	err := row.Scan(&ts)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Unix(ts, 0)
+
+	return &t, nil
+
+}
+
+func (sqliteStore) InsertUrl(ctx context.Context, db *sql.DB, row *types.UrlRow) error {
+	const qry = `
+		INSERT OR REPLACE INTO urls(url_md5, url, title, description, last_visit)
+			VALUES(?, ?, ?, ?, MAX(?, COALESCE((SELECT last_visit FROM urls WHERE url_md5 = ?), 0)));
+	`
+	var lastVisit int64
+	if row.LastVisit != nil {
+		lastVisit = row.LastVisit.Unix()
+	}
+	md5 := util.HashMd5String(row.Url)
+
+	// Re-importing a url must not reset the last_visit InsertVisit recorded.
+	_, err := db.ExecContext(ctx, qry, md5, row.Url, row.Title, row.Description, lastVisit, md5)
+	return err
+}
+
+func (sqliteStore) InsertUrlMeta(ctx context.Context, db *sql.DB, row *types.UrlMetaRow) error {
+	const qry = `
+		INSERT OR REPLACE INTO urls_meta(url_md5, indexed_at)
+			VALUES(?, ?);
+	`
+	md5 := util.HashMd5String(row.Url)
+	var indexed_at int64
+
+	if row.IndexedAt != nil {
+		indexed_at = row.IndexedAt.Unix()
+	}
+
+	_, err := db.ExecContext(ctx, qry, md5, indexed_at)
+	return err
+}
+
+func (sqliteStore) InsertVisit(ctx context.Context, db *sql.DB, row *types.VisitRow) error {
+	const qry = `
+		INSERT OR IGNORE INTO visits(url_md5, visit_time, source, profile)
+			VALUES(?, ?, ?, ?);
+	`
+	md5 := util.HashMd5String(row.Url)
+
+	if _, err := db.ExecContext(ctx, qry, md5, row.Datetime.Unix(), row.ExtractorName, row.ProfileID); err != nil {
+		return err
+	}
+
+	// Nothing populates urls.last_visit on insert -- extractors only know a
+	// url's title/description, not when it was last visited -- so it has to
+	// be kept up to date here, where a visit time actually becomes available.
+	// MAX keeps it monotonic when visits for the same url arrive out of order
+	// (e.g. across profiles/browsers being synced independently).
+	const updateQry = `UPDATE urls SET last_visit = MAX(COALESCE(last_visit, 0), ?) WHERE url_md5 = ?;`
+	_, err := db.ExecContext(ctx, updateQry, row.Datetime.Unix(), md5)
+	return err
+}
+
+func (sqliteStore) InsertBookmark(ctx context.Context, db *sql.DB, row *types.BookmarkRow) error {
+	const qry = `
+		INSERT OR REPLACE INTO bookmarks(url_md5, title, folder_path, extractor_name, added_at, updated_at)
+			VALUES(?, ?, ?, ?, ?, ?);
+	`
+	md5 := util.HashMd5String(row.Url)
+
+	var addedAt, updatedAt int64
+	if row.AddedAt != nil {
+		addedAt = row.AddedAt.Unix()
+	}
+	if row.UpdatedAt != nil {
+		updatedAt = row.UpdatedAt.Unix()
+	}
+
+	_, err := db.ExecContext(ctx, qry, md5, row.Title, row.FolderPath, row.ExtractorName, addedAt, updatedAt)
+	return err
+}
+
+// CountUrlsWhere counts the number of urls that match the given where clause. URL meta is available in the where clause as well.
+func (sqliteStore) CountUrlsWhere(ctx context.Context, db *sql.DB, where string, args ...interface{}) (int, error) {
+	var qry = `
+		SELECT
+			COUNT(*)
+		FROM
+			urls
+			LEFT OUTER JOIN urls_meta ON urls.url_md5 = urls_meta.url_md5
+		WHERE %s;
+	`
+	qry = fmt.Sprintf(qry, where)
+	row := db.QueryRowContext(ctx, qry, args...)
+	if err := row.Err(); err != nil {
+		return 0, err
+	}
+
+	var count int
+	err := row.Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (sqliteStore) UrlsById(ctx context.Context, db *sql.DB, ids ...string) ([]types.UrlDbEntity, error) {
+	qry := fmt.Sprintf(
+		`SELECT
+				url_md5,
+				url,
+				title,
+				description,
+				last_visit
+			FROM
+				urls
+			WHERE
+				url_md5 IN (%s);
+		`,
+		strings.Join(
+			lo.Map(ids, func(id string, _ int) string { return "?" }),
+			",",
+		),
+	)
+
+	// C'mon Go, don't expose your implementation details (this conversion is
+	// necessary becuase of underlying mem representation):
+	// https://go.dev/doc/faq#convert_slice_of_interface
+	var args []any
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []types.UrlDbEntity
+	for rows.Next() {
+		var url types.UrlDbEntity
+		var ts int64
+
+		err := rows.Scan(&url.UrlMd5, &url.Url, &url.Title, &url.Description, &ts)
+		if err != nil {
+			return nil, err
+		}
+
+		if ts != 0 {
+			t := time.Unix(ts, 0)
+			url.LastVisit = &t
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// ListUrls returns up to limit urls last visited at or after since, most
+// recently visited first.
+func (sqliteStore) ListUrls(ctx context.Context, db *sql.DB, since time.Time, cursor string, limit int) ([]types.UrlDbEntity, error) {
+	qry := `
+		SELECT
+			url_md5,
+			url,
+			title,
+			description,
+			last_visit
+		FROM
+			urls
+		WHERE
+			last_visit >= ?
+	`
+	args := []any{since.Unix()}
+
+	if cursor != "" {
+		cursorVisit, cursorMd5, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		qry += ` AND (last_visit < ? OR (last_visit = ? AND url_md5 < ?))`
+		args = append(args, cursorVisit, cursorVisit, cursorMd5)
+	}
+
+	qry += `
+		ORDER BY
+			last_visit DESC,
+			url_md5 DESC
+		LIMIT ?;
+	`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []types.UrlDbEntity
+	for rows.Next() {
+		var u types.UrlDbEntity
+		var ts int64
+
+		if err := rows.Scan(&u.UrlMd5, &u.Url, &u.Title, &u.Description, &ts); err != nil {
+			return nil, err
+		}
+
+		if ts != 0 {
+			t := time.Unix(ts, 0)
+			u.LastVisit = &t
+		}
+
+		urls = append(urls, u)
+	}
+
+	return urls, rows.Err()
+}
+
+// VisitsByUrlMd5 returns every recorded visit to the url identified by
+// urlMd5, most recent first.
+func (sqliteStore) VisitsByUrlMd5(ctx context.Context, db *sql.DB, urlMd5 string) ([]types.VisitDbEntity, error) {
+	const qry = `
+		SELECT
+			url_md5,
+			visit_time,
+			source,
+			profile
+		FROM
+			visits
+		WHERE
+			url_md5 = ?
+		ORDER BY
+			visit_time DESC;
+	`
+
+	rows, err := db.QueryContext(ctx, qry, urlMd5)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []types.VisitDbEntity
+	for rows.Next() {
+		var v types.VisitDbEntity
+		var ts int64
+
+		if err := rows.Scan(&v.UrlMd5, &ts, &v.Source, &v.Profile); err != nil {
+			return nil, err
+		}
+
+		v.VisitTime = time.Unix(ts, 0)
+		visits = append(visits, v)
+	}
+
+	return visits, rows.Err()
+}
+
+// GetVisitStats reports, for each of ids, the visit count and most recent
+// visit time, used by ranked search to weigh popularity and recency.
+func (sqliteStore) GetVisitStats(ctx context.Context, db *sql.DB, ids ...string) (map[string]types.VisitStats, error) {
+	qry := fmt.Sprintf(
+		`SELECT
+				url_md5,
+				COUNT(*),
+				MAX(visit_time)
+			FROM
+				visits
+			WHERE
+				url_md5 IN (%s)
+			GROUP BY
+				url_md5;
+		`,
+		strings.Join(
+			lo.Map(ids, func(id string, _ int) string { return "?" }),
+			",",
+		),
+	)
+
+	var args []any
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]types.VisitStats, len(ids))
+	for rows.Next() {
+		var s types.VisitStats
+		var ts int64
+
+		if err := rows.Scan(&s.UrlMd5, &s.Count, &ts); err != nil {
+			return nil, err
+		}
+
+		s.LastVisit = time.Unix(ts, 0)
+		stats[s.UrlMd5] = s
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,350 @@
+package populate
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/iansinnott/browser-gopher/pkg/persistence"
+	"github.com/iansinnott/browser-gopher/pkg/types"
+	"github.com/iansinnott/browser-gopher/pkg/util"
+	"github.com/iansinnott/browser-gopher/pkg/webhooks"
+)
+
+// hostOf returns the lowercased hostname of rawUrl, or "" if it can't be
+// parsed. Indexed alongside the rest of a document so ranked search can
+// boost matches against the domain a user is looking for. Lowercased
+// because the host field is indexed with the "keyword" analyzer (so a full
+// hostname matches as one term), which -- unlike the default analyzer --
+// doesn't fold case on its own.
+func hostOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// bookmarkDocPrefix distinguishes a bookmark's Bleve document id from the
+// "history" document the same url (and url_md5) may also have via
+// indexUrlRows -- both would otherwise share one document, so whichever of
+// populateBookmarks/indexUrlRows ran most recently would silently overwrite
+// the other's "kind" tag.
+const bookmarkDocPrefix = "bookmark:"
+
+func bookmarkDocID(urlMd5 string) string {
+	return bookmarkDocPrefix + urlMd5
+}
+
+// UrlMd5FromDocID recovers the url_md5 a Bleve hit was indexed under,
+// stripping the "bookmark:" prefix bookmarkDocID adds for bookmark
+// documents. Search results should always resolve ids through this rather
+// than using a hit's id directly, since a bookmark document's id isn't
+// itself a valid url_md5.
+func UrlMd5FromDocID(docID string) string {
+	return strings.TrimPrefix(docID, bookmarkDocPrefix)
+}
+
+// index is the process-wide search index, opened lazily by GetIndex.
+var index bleve.Index
+
+// GetIndex returns the search index, opening it from config.Config.IndexPath
+// (creating it if it doesn't exist yet) the first time it's called.
+func GetIndex() (*bleve.Index, error) {
+	if index != nil {
+		return &index, nil
+	}
+
+	idx, err := bleve.Open(config.Config.IndexPath)
+	if err == nil {
+		index = idx
+		return &index, nil
+	}
+
+	// host is indexed whole (via the "keyword" analyzer) rather than
+	// tokenized, so a TermQuery against it can match a full hostname like
+	// "reddit.com" -- the default analyzer would otherwise split it into
+	// separate "reddit"/"com" terms.
+	hostFieldMapping := bleve.NewTextFieldMapping()
+	hostFieldMapping.Analyzer = "keyword"
+
+	docMapping := bleve.NewDocumentMapping()
+	docMapping.AddFieldMappingsAt("host", hostFieldMapping)
+
+	mapping := bleve.NewIndexMapping()
+	mapping.DefaultMapping = docMapping
+
+	idx, err = bleve.New(config.Config.IndexPath, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	index = idx
+	return &index, nil
+}
+
+// openSourceAtPath opens a connection to a browser's own history database.
+// The connection is not opened in read-only mode; only the extractors'
+// SELECT queries are run against it. dbPath doesn't need to be the live,
+// in-use file -- callers such as the watch daemon pass a temp copy instead,
+// since browsers hold an exclusive lock on the original.
+func openSourceAtPath(dbPath string) (*sql.DB, error) {
+	return sql.Open("sqlite", dbPath)
+}
+
+// PopulateAll imports every url and visit a single extractor can see into
+// our own database.
+func PopulateAll(x types.Extractor) error {
+	return PopulateSinceTime(x, time.Unix(0, 0))
+}
+
+// PopulateSinceTime imports urls and visits from a single extractor's own
+// database, skipping visits that happened before since.
+func PopulateSinceTime(x types.Extractor, since time.Time) error {
+	return populateSinceTime(x, x.GetDBPath(), since)
+}
+
+// PopulateSinceTimeFromPath behaves like PopulateSinceTime, but reads from
+// dbPath instead of x.GetDBPath(). The watch daemon uses this to import
+// from a temporary copy of a live, locked database.
+func PopulateSinceTimeFromPath(x types.Extractor, dbPath string, since time.Time) error {
+	return populateSinceTime(x, dbPath, since)
+}
+
+// populateSinceTime does the actual import work. Extractors don't currently
+// support filtering at the source query level, so we fetch everything and
+// filter client side -- acceptable at the scale of a single browser profile.
+func populateSinceTime(x types.Extractor, dbPath string, since time.Time) error {
+	ctx := context.Background()
+
+	srcConn, err := openSourceAtPath(dbPath)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	dbConn, err := persistence.InitDb(ctx, config.Config)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	urls, err := x.GetAllUrls(ctx, srcConn)
+	if err != nil {
+		return err
+	}
+
+	urlByAddress := make(map[string]types.UrlRow, len(urls))
+	for _, u := range urls {
+		if err := persistence.InsertUrl(ctx, dbConn, &u); err != nil {
+			return err
+		}
+		urlByAddress[u.Url] = u
+	}
+
+	visits, err := x.GetAllVisits(ctx, srcConn)
+	if err != nil {
+		return err
+	}
+
+	if err := webhooks.EnsureTables(ctx, config.Config, dbConn); err != nil {
+		return err
+	}
+
+	for _, v := range visits {
+		if v.Datetime.Before(since) {
+			continue
+		}
+		v.ExtractorName = x.GetName()
+		v.ProfileID = x.GetProfile().ProfileID
+		if err := persistence.InsertVisit(ctx, dbConn, &v); err != nil {
+			return err
+		}
+
+		// populate and watch run as their own OS processes, separate from
+		// `serve` (see pkg/watcher's doc comment) -- this only persists a
+		// pending delivery row; whichever process is actually running
+		// `serve`'s dispatcher picks it up and sends it.
+		u := urlByAddress[v.Url]
+		if _, err := webhooks.Notify(ctx, config.Config, dbConn, "visit.created", map[string]interface{}{
+			"url":            v.Url,
+			"title":          u.Title,
+			"datetime":       v.Datetime,
+			"extractor_name": v.ExtractorName,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PopulateBookmarks imports every bookmark a single extractor can see from
+// its own database into our own database and indexes them for search.
+// Extractors that don't implement types.BookmarkExtractor are silently
+// skipped.
+func PopulateBookmarks(x types.Extractor) error {
+	return populateBookmarks(x, x.GetDBPath())
+}
+
+// PopulateBookmarksFromPath behaves like PopulateBookmarks, but opens the
+// source connection passed to GetAllBookmarks on dbPath instead of
+// x.GetDBPath(). The watch daemon passes a temporary copy of Chromium's
+// Bookmarks file here. ChromiumExtractor.GetAllBookmarks ignores that
+// connection and always reads the Bookmarks file next to its HistoryDBPath,
+// so for Chromium the copy at dbPath is not read.
+func PopulateBookmarksFromPath(x types.Extractor, dbPath string) error {
+	return populateBookmarks(x, dbPath)
+}
+
+func populateBookmarks(x types.Extractor, dbPath string) error {
+	bx, ok := x.(types.BookmarkExtractor)
+	if !ok {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	srcConn, err := openSourceAtPath(dbPath)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	dbConn, err := persistence.InitDb(ctx, config.Config)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	bookmarks, err := bx.GetAllBookmarks(ctx, srcConn)
+	if err != nil {
+		return err
+	}
+
+	idx, err := GetIndex()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bookmarks {
+		if err := persistence.InsertUrl(ctx, dbConn, &types.UrlRow{Url: b.Url, Title: b.Title}); err != nil {
+			return err
+		}
+
+		if err := persistence.InsertBookmark(ctx, dbConn, &b); err != nil {
+			return err
+		}
+
+		doc := map[string]interface{}{
+			"url":         b.Url,
+			"title":       b.Title,
+			"folder_path": b.FolderPath,
+			"host":        hostOf(b.Url),
+			"kind":        "bookmark",
+		}
+		urlMd5 := util.HashMd5String(b.Url)
+		if err := (*idx).Index(bookmarkDocID(urlMd5), doc); err != nil {
+			return err
+		}
+
+		// Recording a urls_meta row marks this url as indexed, so IndexPending
+		// skips it instead of also adding a kind:"history" document for it.
+		// BuildIndex still indexes every url, this one included, as history.
+		if err := persistence.InsertUrlMeta(ctx, dbConn, &types.UrlMetaRow{Url: b.Url, IndexedAt: timePtr(time.Now())}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BuildIndex (re)indexes every url currently in our database into the
+// search index, returning the number of records indexed.
+func BuildIndex(ctx context.Context, dbConn *sql.DB) (int, error) {
+	rows, err := dbConn.QueryContext(ctx, `
+SELECT
+  urls.url_md5,
+  urls.url,
+  urls.title,
+  urls.description
+FROM
+  urls;
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return indexUrlRows(ctx, dbConn, rows)
+}
+
+// IndexPending indexes only urls that haven't been indexed yet (no
+// urls_meta row), returning the number of records indexed. Unlike
+// BuildIndex, it doesn't touch urls that are already in the index, which
+// makes it cheap enough to call after every incremental sync.
+func IndexPending(ctx context.Context, dbConn *sql.DB) (int, error) {
+	rows, err := dbConn.QueryContext(ctx, `
+SELECT
+  urls.url_md5,
+  urls.url,
+  urls.title,
+  urls.description
+FROM
+  urls
+  LEFT JOIN urls_meta ON urls.url_md5 = urls_meta.url_md5
+WHERE
+  urls_meta.url_md5 IS NULL;
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return indexUrlRows(ctx, dbConn, rows)
+}
+
+// indexUrlRows indexes every (url_md5, url, title, description) row from
+// rows into the search index and records it as indexed in urls_meta.
+func indexUrlRows(ctx context.Context, dbConn *sql.DB, rows *sql.Rows) (int, error) {
+	idx, err := GetIndex()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for rows.Next() {
+		var urlMd5, url, title, description string
+		if err := rows.Scan(&urlMd5, &url, &title, &description); err != nil {
+			return n, err
+		}
+
+		doc := map[string]interface{}{
+			"url":         url,
+			"title":       title,
+			"description": description,
+			"host":        hostOf(url),
+			"kind":        "history",
+		}
+
+		if err := (*idx).Index(urlMd5, doc); err != nil {
+			return n, err
+		}
+
+		if err := persistence.InsertUrlMeta(ctx, dbConn, &types.UrlMetaRow{Url: url, IndexedAt: timePtr(time.Now())}); err != nil {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, rows.Err()
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -1,14 +1,31 @@
+// Package search ranks and retrieves urls out of the Bleve index built by
+// pkg/populate.
 package search
 
 import (
 	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/iansinnott/browser-gopher/pkg/config"
 	"github.com/iansinnott/browser-gopher/pkg/persistence"
 	"github.com/iansinnott/browser-gopher/pkg/populate"
+	"github.com/iansinnott/browser-gopher/pkg/types"
 )
 
+// URLQueryResult is the result of a search: the matched urls, in whatever
+// order SearchUrls decided (lexical relevance, or re-ranked -- see rank),
+// alongside the raw Bleve result they came from.
+type URLQueryResult struct {
+	Urls  []types.UrlDbEntity
+	Count uint
+	Meta  *bleve.SearchResult
+}
+
 type BleveSearchProvider struct {
 	ctx  context.Context
 	conf *config.AppConfig
@@ -18,11 +35,47 @@ func NewBleveSearchProvider(ctx context.Context, conf *config.AppConfig) BleveSe
 	return BleveSearchProvider{ctx: ctx, conf: conf}
 }
 
-func (p BleveSearchProvider) SearchBleve(query string) (*bleve.SearchResult, error) {
-	qry := bleve.NewQueryStringQuery(query)
+// SearchBleve builds a scored query out of query: a title phrase match is
+// boosted highest, since it's the strongest signal of intent, then a url
+// host term match (catches navigational queries that spell out a url's
+// whole hostname, like "reddit.com"; a partial host such as "reddit" does
+// not match this disjunct), then a description match. The original query-string query
+// is kept as a fallback disjunct so bleve's own syntax (quoted phrases,
+// field queries, etc.) still works for anyone relying on it.
+//
+// kind optionally filters to a single indexed document kind ("history" or
+// "bookmark"); an empty kind matches both, which is what every search did
+// before bookmarks were indexed alongside history.
+func (p BleveSearchProvider) SearchBleve(query string, kind string) (*bleve.SearchResult, error) {
+	titleQry := bleve.NewMatchPhraseQuery(query)
+	titleQry.SetField("title")
+	titleQry.SetBoost(3.0)
+
+	descQry := bleve.NewMatchQuery(query)
+	descQry.SetField("description")
+	descQry.SetBoost(1.0)
+
+	// The host field is indexed with the "keyword" analyzer, which stores it
+	// as a single verbatim token rather than lowercasing it -- hostOf does
+	// the lowercasing before indexing instead. A TermQuery matches verbatim
+	// against indexed terms, so it has to be lowercased the same way here or
+	// it'll never match an uppercase query.
+	hostQry := bleve.NewTermQuery(strings.ToLower(query))
+	hostQry.SetField("host")
+	hostQry.SetBoost(2.0)
+
+	fallbackQry := bleve.NewQueryStringQuery(query)
+
+	var qry bleve.Query = bleve.NewDisjunctionQuery(titleQry, descQry, hostQry, fallbackQry)
+	if kind != "" {
+		kindQry := bleve.NewTermQuery(kind)
+		kindQry.SetField("kind")
+		qry = bleve.NewConjunctionQuery(qry, kindQry)
+	}
+
 	req := bleve.NewSearchRequest(qry)
 	req.Size = 100
-	req.Fields = append(req.Fields, "id", "url", "title", "description", "last_visit")
+	req.Fields = append(req.Fields, "id", "url", "title", "description", "last_visit", "kind")
 	req.IncludeLocations = true
 
 	idx, err := populate.GetIndex()
@@ -33,15 +86,41 @@ func (p BleveSearchProvider) SearchBleve(query string) (*bleve.SearchResult, err
 	return (*idx).Search(req)
 }
 
-func (p BleveSearchProvider) SearchUrls(query string) (*URLQueryResult, error) {
-	result, err := p.SearchBleve(query)
+// SearchUrls runs SearchBleve and resolves the hits against our own
+// database. When rank is true, hits are additionally re-scored by visit
+// frequency and recency (see finalScore) and returned in that order;
+// when false, Bleve's own relevance order is kept as-is. kind optionally
+// restricts the search to "history" or "bookmark" documents; pass "" to
+// search both, as every caller did before bookmarks were indexed.
+func (p BleveSearchProvider) SearchUrls(query string, rank bool, kind string) (*URLQueryResult, error) {
+	queryType := "lexical"
+	if rank {
+		queryType = "ranked"
+	}
+	start := time.Now()
+	defer func() { recordLatency(queryType, time.Since(start)) }()
+
+	result, err := p.SearchBleve(query, kind)
 	if err != nil {
 		return nil, err
 	}
 
-	ids := make([]string, len(result.Hits))
-	for i, hit := range result.Hits {
-		ids[i] = hit.ID
+	// A bookmarked url and its visit history can each have their own Bleve
+	// document sharing one underlying url_md5 (see populate.UrlMd5FromDocID),
+	// so collapse hits back down to one id per url before resolving against
+	// our own database, keeping the higher of the two scores.
+	ids := make([]string, 0, len(result.Hits))
+	bleveScores := make(map[string]float64, len(result.Hits))
+	seen := make(map[string]bool, len(result.Hits))
+	for _, hit := range result.Hits {
+		md5 := populate.UrlMd5FromDocID(hit.ID)
+		if hit.Score > bleveScores[md5] {
+			bleveScores[md5] = hit.Score
+		}
+		if !seen[md5] {
+			seen[md5] = true
+			ids = append(ids, md5)
+		}
 	}
 
 	conn, err := persistence.OpenConnection(p.ctx, p.conf)
@@ -55,5 +134,110 @@ func (p BleveSearchProvider) SearchUrls(query string) (*URLQueryResult, error) {
 		return nil, err
 	}
 
-	return &URLQueryResult{Urls: xs, Count: uint(result.Total), Meta: result}, err
+	// UrlsById returns rows in database order; restore Bleve's hit order.
+	hitPos := make(map[string]int, len(ids))
+	for i, id := range ids {
+		hitPos[id] = i
+	}
+	sort.SliceStable(xs, func(i, j int) bool {
+		return hitPos[xs[i].UrlMd5] < hitPos[xs[j].UrlMd5]
+	})
+
+	if rank {
+		stats, err := persistence.GetVisitStats(p.ctx, conn, ids...)
+		if err != nil {
+			return nil, err
+		}
+
+		halfLife := p.conf.SearchHalfLifeDays
+		if halfLife <= 0 {
+			halfLife = 90
+		}
+
+		now := time.Now()
+		scores := make(map[string]float64, len(xs))
+		for _, u := range xs {
+			scores[u.UrlMd5] = finalScore(bleveScores[u.UrlMd5], stats[u.UrlMd5], halfLife, now)
+		}
+
+		sort.SliceStable(xs, func(i, j int) bool {
+			return scores[xs[i].UrlMd5] > scores[xs[j].UrlMd5]
+		})
+	}
+
+	return &URLQueryResult{Urls: xs, Count: uint(result.Total), Meta: result}, nil
+}
+
+// finalScore combines bleve's lexical relevance score with how often a url
+// has been visited and how recently, so a frequently-revisited page can
+// outrank a one-off lexical match:
+//
+//	finalScore = bleveScore * (1 + log1p(visitCount)) * exp(-age_days / halfLifeDays)
+func finalScore(bleveScore float64, stats types.VisitStats, halfLifeDays float64, now time.Time) float64 {
+	popularity := 1 + math.Log1p(float64(stats.Count))
+
+	recency := 1.0
+	if !stats.LastVisit.IsZero() {
+		ageDays := now.Sub(stats.LastVisit).Hours() / 24
+		if ageDays < 0 {
+			ageDays = 0
+		}
+		recency = math.Exp(-ageDays / halfLifeDays)
+	}
+
+	return bleveScore * popularity * recency
+}
+
+// latencyMu guards latencyByType, a process-wide histogram of search
+// latencies keyed by query type ("lexical" or "ranked"). It's deliberately
+// simple -- just enough to answer "is ranked search meaningfully slower" --
+// rather than pulling in a metrics library for a single-process CLI tool.
+var (
+	latencyMu     sync.Mutex
+	latencyByType = map[string][]time.Duration{}
+)
+
+func recordLatency(queryType string, d time.Duration) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	latencyByType[queryType] = append(latencyByType[queryType], d)
+}
+
+// LatencySummary summarizes the latencies recorded so far for a single
+// query type.
+type LatencySummary struct {
+	QueryType string
+	Count     int
+	Total     time.Duration
+	Mean      time.Duration
+}
+
+// LatencySummaries returns a summary of every query type recorded so far,
+// sorted by query type.
+func LatencySummaries() []LatencySummary {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	summaries := make([]LatencySummary, 0, len(latencyByType))
+	for queryType, durations := range latencyByType {
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+
+		var mean time.Duration
+		if len(durations) > 0 {
+			mean = total / time.Duration(len(durations))
+		}
+
+		summaries = append(summaries, LatencySummary{
+			QueryType: queryType,
+			Count:     len(durations),
+			Total:     total,
+			Mean:      mean,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].QueryType < summaries[j].QueryType })
+	return summaries
 }
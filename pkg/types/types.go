@@ -0,0 +1,104 @@
+package types
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UrlRow is a single URL as extracted from a browser's history database,
+// before it has been hashed and inserted into our own store.
+type UrlRow struct {
+	Url         string
+	Title       string
+	Description string
+	LastVisit   *time.Time
+}
+
+// VisitRow is a single visit to a URL, as extracted from a browser's history
+// database.
+type VisitRow struct {
+	Url           string
+	Datetime      time.Time
+	ExtractorName string
+	ProfileID     string
+}
+
+// UrlMetaRow tracks metadata about a URL that isn't sourced from a browser,
+// e.g. whether and when it was indexed for search.
+type UrlMetaRow struct {
+	Url       string
+	IndexedAt *time.Time
+}
+
+// UrlDbEntity is a URL as read back out of our own database, keyed by its
+// url_md5.
+type UrlDbEntity struct {
+	UrlMd5      string
+	Url         string
+	Title       string
+	Description string
+	LastVisit   *time.Time
+}
+
+// Profile identifies a single browser profile, e.g. Chrome's "Profile 1" or
+// a Firefox profile from profiles.ini. Safari doesn't support multiple
+// profiles, so it's always represented by a single Profile.
+type Profile struct {
+	BrowserName        string
+	ProfileID          string
+	ProfileDisplayName string
+	DBPath             string
+}
+
+// ProfileManager enumerates the profiles available under a single browser's
+// root directory (e.g. "~/Library/Application Support/Google/Chrome/").
+type ProfileManager interface {
+	ListProfiles(root string) ([]Profile, error)
+}
+
+// Extractor knows how to pull urls and visits out of a single browser
+// profile's history database.
+type Extractor interface {
+	GetName() string
+	GetDBPath() string
+	GetProfile() Profile
+	GetAllUrls(ctx context.Context, conn *sql.DB) ([]UrlRow, error)
+	GetAllVisits(ctx context.Context, conn *sql.DB) ([]VisitRow, error)
+}
+
+// BookmarkRow is a single bookmark as extracted from a browser, before it
+// has been hashed and inserted into our own store.
+type BookmarkRow struct {
+	Url           string
+	Title         string
+	FolderPath    string
+	ExtractorName string
+	AddedAt       *time.Time
+	UpdatedAt     *time.Time
+}
+
+// VisitStats aggregates how often, and how recently, a url was visited.
+// Used by ranked search to combine lexical relevance with popularity and
+// freshness signals.
+type VisitStats struct {
+	UrlMd5    string
+	Count     int
+	LastVisit time.Time
+}
+
+// VisitDbEntity is a single visit as read back out of our own database.
+type VisitDbEntity struct {
+	UrlMd5    string
+	VisitTime time.Time
+	Source    string
+	Profile   string
+}
+
+// BookmarkExtractor is implemented by extractors that can also pull
+// bookmarks out of their browser, in addition to urls/visits. Not every
+// Extractor supports this, so it's kept separate from Extractor itself and
+// should be accessed via a type assertion.
+type BookmarkExtractor interface {
+	GetAllBookmarks(ctx context.Context, conn *sql.DB) ([]BookmarkRow, error)
+}
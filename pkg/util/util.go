@@ -0,0 +1,42 @@
+package util
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Expanduser expands a leading "~" in path to the current user's home
+// directory, mirroring the shell convention browser paths are usually
+// documented with.
+func Expanduser(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// HashMd5String returns the hex-encoded md5 hash of s. Used to derive the
+// stable url_md5 primary key for a URL.
+func HashMd5String(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// sqliteDatetimeLayout is the format produced by SQLite's datetime() function.
+const sqliteDatetimeLayout = "2006-01-02 15:04:05"
+
+// ParseSQLiteDatetime parses a timestamp as returned by SQLite's datetime()
+// function (e.g. "2022-01-02 15:04:05") into a time.Time in UTC.
+func ParseSQLiteDatetime(s string) (time.Time, error) {
+	return time.ParseInLocation(sqliteDatetimeLayout, s, time.UTC)
+}
@@ -0,0 +1,229 @@
+// Package watcher implements a long-lived daemon that watches each
+// extractor's history (and, for Chromium, bookmarks) database for writes
+// and incrementally syncs them into our own database and search index.
+// This is the live counterpart to running `populate --latest` from cron.
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/iansinnott/browser-gopher/pkg/config"
+	"github.com/iansinnott/browser-gopher/pkg/extractors"
+	"github.com/iansinnott/browser-gopher/pkg/persistence"
+	"github.com/iansinnott/browser-gopher/pkg/populate"
+	"github.com/iansinnott/browser-gopher/pkg/types"
+)
+
+// debounce is how long we wait after the last write to a watched file
+// before syncing it, so a burst of writes (browsers checkpoint their sqlite
+// db frequently) only triggers a single sync.
+const debounce = 2 * time.Second
+
+// Status reports the outcome of the most recent sync of a single watched
+// path, so a long-running `watch` process can surface it to the user.
+type Status struct {
+	Path         string
+	RecordsAdded int
+	LastSyncedAt time.Time
+	LastError    error
+}
+
+// target is a single file we watch for changes, paired with the extractor
+// (and what kind of data it holds) a change to it should sync.
+type target struct {
+	path      string
+	extractor types.Extractor
+	kind      string // "history" or "bookmarks"
+}
+
+// Watcher observes each extractor's history (and, for Chromium, bookmarks)
+// database for writes and incrementally syncs them into our own db and
+// search index.
+type Watcher struct {
+	targets []target
+	locks   map[string]*sync.Mutex
+
+	statusMu sync.Mutex
+	status   map[string]Status
+}
+
+// New builds a Watcher over every path the given extractors expose. Paths
+// that don't currently exist on disk are skipped.
+func New(extractorList []types.Extractor) *Watcher {
+	w := &Watcher{
+		locks:  map[string]*sync.Mutex{},
+		status: map[string]Status{},
+	}
+
+	for _, x := range extractorList {
+		w.addTarget(x.GetDBPath(), x, "history")
+
+		if cx, ok := x.(*extractors.ChromiumExtractor); ok {
+			bookmarksPath := filepath.Join(filepath.Dir(cx.HistoryDBPath), "Bookmarks")
+			w.addTarget(bookmarksPath, x, "bookmarks")
+		}
+	}
+
+	return w
+}
+
+func (w *Watcher) addTarget(path string, x types.Extractor, kind string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	w.targets = append(w.targets, target{path: path, extractor: x, kind: kind})
+	w.locks[path] = &sync.Mutex{}
+}
+
+// TargetCount returns the number of files being watched.
+func (w *Watcher) TargetCount() int {
+	return len(w.targets)
+}
+
+// Status returns a snapshot of the last sync result for every watched path
+// that has synced at least once.
+func (w *Watcher) Status() []Status {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+
+	statuses := make([]Status, 0, len(w.status))
+	for _, s := range w.status {
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+func (w *Watcher) setStatus(path string, recordsAdded int, err error) {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	w.status[path] = Status{Path: path, RecordsAdded: recordsAdded, LastSyncedAt: time.Now(), LastError: err}
+}
+
+// Run watches every target's file for writes and syncs it (debounced)
+// until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+
+	for _, t := range w.targets {
+		if err := fsw.Add(t.path); err != nil {
+			return fmt.Errorf("could not watch %s: %w", t.path, err)
+		}
+	}
+
+	timers := map[string]*time.Timer{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Println("watcher error:", err)
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+
+			t := w.targetFor(event.Name)
+			if t == nil {
+				continue
+			}
+
+			if timer, exists := timers[t.path]; exists {
+				timer.Reset(debounce)
+				continue
+			}
+			timers[t.path] = time.AfterFunc(debounce, func() { w.sync(ctx, *t) })
+		}
+	}
+}
+
+func (w *Watcher) targetFor(path string) *target {
+	for i := range w.targets {
+		if w.targets[i].path == path {
+			return &w.targets[i]
+		}
+	}
+	return nil
+}
+
+// sync copies the live db to a temp path (browsers hold an exclusive lock
+// on the original), imports anything new since the last sync, and
+// incrementally updates the search index. For a "bookmarks" target the
+// copy is made, but ChromiumExtractor reads its live Bookmarks file instead
+// (see populate.PopulateBookmarksFromPath).
+func (w *Watcher) sync(ctx context.Context, t target) {
+	mu := w.locks[t.path]
+	mu.Lock()
+	defer mu.Unlock()
+
+	tmpPath, err := copyToTemp(t.path)
+	if err != nil {
+		w.setStatus(t.path, 0, err)
+		return
+	}
+	defer os.Remove(tmpPath)
+
+	dbConn, err := persistence.InitDb(ctx, config.Config)
+	if err != nil {
+		w.setStatus(t.path, 0, err)
+		return
+	}
+	defer dbConn.Close()
+
+	if t.kind == "bookmarks" {
+		if err := populate.PopulateBookmarksFromPath(t.extractor, tmpPath); err != nil {
+			w.setStatus(t.path, 0, err)
+			return
+		}
+	} else {
+		since := time.Unix(0, 0)
+		if latest, err := persistence.GetLatestTime(ctx, dbConn, t.extractor); err == nil && latest != nil {
+			since = *latest
+		}
+		if err := populate.PopulateSinceTimeFromPath(t.extractor, tmpPath, since); err != nil {
+			w.setStatus(t.path, 0, err)
+			return
+		}
+	}
+
+	n, err := populate.IndexPending(ctx, dbConn)
+	w.setStatus(t.path, n, err)
+}
+
+func copyToTemp(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "browser-gopher-watch-*")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+
+	return dst.Name(), nil
+}
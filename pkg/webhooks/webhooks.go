@@ -0,0 +1,180 @@
+// Package webhooks persists webhook registrations and pending deliveries.
+// It's deliberately independent of pkg/api so that pkg/populate and
+// pkg/watcher -- which run as their own OS processes, separate from
+// `serve` (see pkg/watcher's doc comment) -- can enqueue a delivery
+// directly against the shared database without importing pkg/api (which
+// already depends on pkg/populate via pkg/search, so the reverse import
+// would cycle). Actually delivering a pending row -- the signed HTTP POST,
+// retries, backoff -- is done by whichever process is running `serve`'s
+// dispatcher, which polls the table this package writes to.
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/iansinnott/browser-gopher/pkg/config"
+)
+
+// sqliteInitSql and postgresInitSql create the tables backing webhook
+// registration and delivery, one per driver: sqlite ids use INTEGER PRIMARY
+// KEY AUTOINCREMENT, Postgres ids use BIGSERIAL. EnsureTables picks the one
+// matching conf.DBDriver.
+const sqliteInitSql = `
+CREATE TABLE IF NOT EXISTS "webhooks" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "url" TEXT NOT NULL,
+  "secret" TEXT NOT NULL,
+  "event" TEXT NOT NULL,
+  "created_at" INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "webhook_id" INTEGER NOT NULL REFERENCES webhooks(id),
+  "payload" TEXT NOT NULL,
+  "status" TEXT NOT NULL,
+  "attempts" INTEGER NOT NULL DEFAULT 0,
+  "next_attempt_at" INTEGER NOT NULL,
+  "last_error" TEXT
+);
+`
+
+const postgresInitSql = `
+CREATE TABLE IF NOT EXISTS webhooks (
+  id BIGSERIAL PRIMARY KEY,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  event TEXT NOT NULL,
+  created_at BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  webhook_id BIGINT NOT NULL REFERENCES webhooks(id),
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at BIGINT NOT NULL,
+  last_error TEXT
+);
+`
+
+// Webhook is a registered delivery target: every Notify for its Event fires
+// a signed POST to Url.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EnsureTables creates the webhooks/webhook_deliveries tables if they don't
+// already exist yet. Safe to call from any process, regardless of whether
+// `serve` has ever run against this database before.
+func EnsureTables(ctx context.Context, conf *config.AppConfig, db *sql.DB) error {
+	initSql := sqliteInitSql
+	if conf.DBDriver == "postgres" {
+		initSql = postgresInitSql
+	}
+	_, err := db.ExecContext(ctx, initSql)
+	return err
+}
+
+// Register persists a new webhook. It doesn't schedule any deliveries --
+// that happens when Notify is called for a matching event.
+func Register(ctx context.Context, conf *config.AppConfig, db *sql.DB, url, secret, event string) (*Webhook, error) {
+	now := time.Now()
+	qry := `INSERT INTO webhooks(url, secret, event, created_at) VALUES(?, ?, ?, ?);`
+	if conf.DBDriver == "postgres" {
+		qry = `INSERT INTO webhooks(url, secret, event, created_at) VALUES($1, $2, $3, $4) RETURNING id;`
+		var id int64
+		if err := db.QueryRowContext(ctx, qry, url, secret, event, now.Unix()).Scan(&id); err != nil {
+			return nil, err
+		}
+		return &Webhook{ID: id, Url: url, Secret: secret, Event: event, CreatedAt: now}, nil
+	}
+
+	res, err := db.ExecContext(ctx, qry, url, secret, event, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook{ID: id, Url: url, Secret: secret, Event: event, CreatedAt: now}, nil
+}
+
+// Notify persists a pending webhook_deliveries row for every webhook
+// registered for event, and returns their ids. It only writes to the
+// database -- actual delivery happens out-of-band, in whichever process is
+// running `serve`'s dispatcher, via its poll loop over pending rows -- so
+// it's safe (and the only supported way) to call this from populate/watch,
+// which never run a dispatcher of their own.
+func Notify(ctx context.Context, conf *config.AppConfig, db *sql.DB, event string, payload interface{}) ([]int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	qry := "SELECT id FROM webhooks WHERE event = ?;"
+	if conf.DBDriver == "postgres" {
+		qry = "SELECT id FROM webhooks WHERE event = $1;"
+	}
+
+	rows, err := db.QueryContext(ctx, qry, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhookIds []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		webhookIds = append(webhookIds, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var deliveryIds []int64
+	for _, id := range webhookIds {
+		deliveryId, err := scheduleDelivery(ctx, conf, db, id, body, time.Now())
+		if err != nil {
+			return deliveryIds, err
+		}
+		deliveryIds = append(deliveryIds, deliveryId)
+	}
+
+	return deliveryIds, nil
+}
+
+func scheduleDelivery(ctx context.Context, conf *config.AppConfig, db *sql.DB, webhookId int64, payload []byte, nextAttempt time.Time) (int64, error) {
+	qry := `
+		INSERT INTO webhook_deliveries(webhook_id, payload, status, attempts, next_attempt_at)
+			VALUES(?, ?, 'pending', 0, ?);
+	`
+	if conf.DBDriver == "postgres" {
+		qry = `
+			INSERT INTO webhook_deliveries(webhook_id, payload, status, attempts, next_attempt_at)
+				VALUES($1, $2, 'pending', 0, $3) RETURNING id;
+		`
+		var id int64
+		err := db.QueryRowContext(ctx, qry, webhookId, string(payload), nextAttempt.Unix()).Scan(&id)
+		return id, err
+	}
+
+	res, err := db.ExecContext(ctx, qry, webhookId, string(payload), nextAttempt.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}